@@ -2,9 +2,11 @@
 package compactor
 
 import (
-	"bytes"
+	"bufio"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -23,7 +25,30 @@ const (
 	ArchiveFormatZip
 )
 
-func createArchiveFile(basePath string, src string, dst string, format ArchiveFormat) error {
+// ArchiveResult represents an archive file created along with its checksums.
+type ArchiveResult struct {
+	// File is the archive file path.
+	File string
+	// Checksums contains the archive hex-encoded message digests keyed by algorithm.
+	Checksums map[string]string
+	// ChecksumFiles contains the checksum file paths written.
+	ChecksumFiles []string
+}
+
+// archiveOptions represents the format specific archive creation options.
+type archiveOptions struct {
+	tar archive.TarOptions
+	zip archive.ZipOptions
+}
+
+func createArchiveFile(basePath string, src string, dst string, format ArchiveFormat, opts archiveOptions) error {
+	_, err := writeArchiveFile(basePath, src, dst, format, opts, nil)
+	return err
+}
+
+// writeArchiveFile creates an archive file streaming its bytes to dst and to the optional hashes at the same time.
+// It returns the final archive file path.
+func writeArchiveFile(basePath string, src string, dst string, format ArchiveFormat, opts archiveOptions, hashes []hash.Hash) (string, error) {
 	var ext string
 	switch format {
 	case ArchiveFormatTar:
@@ -33,7 +58,7 @@ func createArchiveFile(basePath string, src string, dst string, format ArchiveFo
 		ext = "zip"
 		break
 	default:
-		return fmt.Errorf("archive format provided is not supported")
+		return "", fmt.Errorf("archive format provided is not supported")
 	}
 
 	dst = strings.TrimSpace(dst)
@@ -47,71 +72,229 @@ func createArchiveFile(basePath string, src string, dst string, format ArchiveFo
 
 	err := os.MkdirAll(filepath.Dir(dst), 0755)
 	if err != nil {
-		return fmt.Errorf("can't create provided parent directories: %s", err)
+		return "", fmt.Errorf("can't create provided parent directories: %s", err)
 	}
 
-	var buf bytes.Buffer
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", err
+	}
+	// The archive is never archived into itself when dst is inside src
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	opts.tar.Exclude = append(opts.tar.Exclude[:len(opts.tar.Exclude):len(opts.tar.Exclude)], fi)
+	opts.zip.Exclude = append(opts.zip.Exclude[:len(opts.zip.Exclude):len(opts.zip.Exclude)], fi)
+	writers := []io.Writer{f}
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	w := bufio.NewWriter(io.MultiWriter(writers...))
 	if format == ArchiveFormatZip {
-		if err := archive.CreateZipballBytes(basePath, src, &buf); err != nil {
-			return err
-		}
+		err = archive.CreateZipballBytesWithOptions(basePath, src, w, opts.zip)
 	}
 	if format == ArchiveFormatTar {
-		if err := archive.CreateTarballBytes(basePath, src, &buf); err != nil {
-			return err
+		err = archive.CreateTarballBytesWithOptions(basePath, src, w, opts.tar)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+// createArchiveFileWithChecksums creates an archive file computing its checksums in a single pass.
+func createArchiveFileWithChecksums(basePath string, src string, dst string, format ArchiveFormat, checksumAlgos []string, checksumDst string) (*ArchiveResult, error) {
+	hashes := make([]hash.Hash, len(checksumAlgos))
+	for i, algo := range checksumAlgos {
+		h, err := checksum.NewHash(algo)
+		if err != nil {
+			return nil, fmt.Errorf("can't create checksum(s): %s", err)
 		}
+		hashes[i] = h
+	}
+	dst, err := writeArchiveFile(basePath, src, dst, format, archiveOptions{}, hashes)
+	if err != nil {
+		return nil, err
+	}
+	res := &ArchiveResult{
+		File:      dst,
+		Checksums: make(map[string]string, len(checksumAlgos)),
+	}
+	checksums := make([]checksum.Checksum, len(checksumAlgos))
+	for i, algo := range checksumAlgos {
+		algo = strings.ToLower(strings.TrimSpace(algo))
+		sum := hex.EncodeToString(hashes[i].Sum(nil))
+		res.Checksums[algo] = sum
+		checksums[i] = checksum.Checksum{Algo: algo, File: dst, Hash: sum}
+	}
+	res.ChecksumFiles, err = checksum.WriteChecksumFiles(checksums, checksumDst, true)
+	if err != nil {
+		return nil, fmt.Errorf("can't create checksum(s): %s", err)
 	}
-	return ioutil.WriteFile(dst, buf.Bytes(), 0755)
+	return res, nil
 }
 
 // CreateTarball archives and compresses a file or folder (src) using Tar/Gzip to dst (tarball).
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateTarball(basePath string, src string, dst string) error {
-	return createArchiveFile(basePath, src, dst, ArchiveFormatTar)
+	return createArchiveFile(basePath, src, dst, ArchiveFormatTar, archiveOptions{})
+}
+
+// CreateTarballWithOptions archives and compresses a file or folder (src) using Tar/Gzip to dst (tarball) with the given options
+// like forced or mapped entry ownership and mode overrides.
+// basePath param specify the base path directory of src path which will be skipped for each archive file header.
+// Otherwise if basePath param is empty then only src path will taken into account.
+func CreateTarballWithOptions(basePath string, src string, dst string, opts archive.TarOptions) error {
+	return createArchiveFile(basePath, src, dst, ArchiveFormatTar, archiveOptions{tar: opts})
 }
 
 // CreateZipball archives and compresses a file or folder (src) using Zip to dst (zipball).
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateZipball(basePath string, src string, dst string) error {
-	return createArchiveFile(basePath, src, dst, ArchiveFormatZip)
+	return createArchiveFile(basePath, src, dst, ArchiveFormatZip, archiveOptions{})
 }
 
-// CreateTarballWithChecksum archives and compresses a file or folder (src) using Tar/Gzip to dst (tarball) with checksum (`md5`, `sha1`, `sha256` or `sha512`). It returns the checksum file path or an error.
+// CreateZipballWithOptions archives and compresses a file or folder (src) using Zip to dst (zipball) with the given options
+// like mode overrides.
+// basePath param specify the base path directory of src path which will be skipped for each archive file header.
+// Otherwise if basePath param is empty then only src path will taken into account.
+func CreateZipballWithOptions(basePath string, src string, dst string, opts archive.ZipOptions) error {
+	return createArchiveFile(basePath, src, dst, ArchiveFormatZip, archiveOptions{zip: opts})
+}
+
+// CreateTarballWithChecksum archives and compresses a file or folder (src) using Tar/Gzip to dst (tarball) with checksum (any registered algorithm like `md5`, `sha1`, `sha256` or `sha512`). It returns the checksum file path or an error.
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateTarballWithChecksum(basePath string, src string, dst string, checksumAlgo string, checksumDst string) (string, error) {
-	if err := CreateTarball(basePath, src, dst); err != nil {
-		return "", err
-	}
-	files, err := checksum.CreateChecksumFiles(
-		[]string{dst},
-		[]string{checksumAlgo},
-		checksumDst,
-		true,
-	)
+	res, err := CreateTarballWithChecksums(basePath, src, dst, []string{checksumAlgo}, checksumDst)
 	if err != nil {
-		return "", fmt.Errorf("can't create checksum(s): %s", err)
+		return "", err
 	}
-	return files[0], nil
+	return res.ChecksumFiles[0], nil
 }
 
-// CreateZipballWithChecksum archives and compresses a file or folder (src) using Zip to dst (Zipball) with checksum (`md5`, `sha1`, `sha256` or `sha512`). It returns the checksum file path or an error.
+// CreateZipballWithChecksum archives and compresses a file or folder (src) using Zip to dst (Zipball) with checksum (any registered algorithm like `md5`, `sha1`, `sha256` or `sha512`). It returns the checksum file path or an error.
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateZipballWithChecksum(basePath, src string, dst string, checksumAlgo string, checksumDst string) (string, error) {
-	if err := CreateZipball(basePath, src, dst); err != nil {
+	res, err := CreateZipballWithChecksums(basePath, src, dst, []string{checksumAlgo}, checksumDst)
+	if err != nil {
 		return "", err
 	}
-	files, err := checksum.CreateChecksumFiles(
-		[]string{dst},
-		[]string{checksumAlgo},
-		checksumDst,
-		true,
-	)
+	return res.ChecksumFiles[0], nil
+}
+
+// CreateTarballWithChecksums archives and compresses a file or folder (src) using Tar/Gzip to dst (tarball) with one checksum file per algorithm.
+// Message digests are computed while the archive is written so the archive file is never read back.
+// It returns the archive result containing the digests and checksum file paths or an error.
+func CreateTarballWithChecksums(basePath string, src string, dst string, checksumAlgos []string, checksumDst string) (*ArchiveResult, error) {
+	return createArchiveFileWithChecksums(basePath, src, dst, ArchiveFormatTar, checksumAlgos, checksumDst)
+}
+
+// CreateZipballWithChecksums archives and compresses a file or folder (src) using Zip to dst (zipball) with one checksum file per algorithm.
+// Message digests are computed while the archive is written so the archive file is never read back.
+// It returns the archive result containing the digests and checksum file paths or an error.
+func CreateZipballWithChecksums(basePath string, src string, dst string, checksumAlgos []string, checksumDst string) (*ArchiveResult, error) {
+	return createArchiveFileWithChecksums(basePath, src, dst, ArchiveFormatZip, checksumAlgos, checksumDst)
+}
+
+// openArchiveFile opens an archive file detecting its format from its content, not its extension.
+func openArchiveFile(path string) (*os.File, ArchiveFormat, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, 0, err
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		f.Close()
+		return nil, 0, 0, &archive.CorruptError{Err: fmt.Errorf("unknown archive format: %s", err)}
+	}
+	var format ArchiveFormat
+	switch {
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		format = ArchiveFormatTar
+	case string(magic) == "PK\x03\x04" || string(magic) == "PK\x05\x06":
+		format = ArchiveFormatZip
+	default:
+		f.Close()
+		return nil, 0, 0, &archive.CorruptError{Err: fmt.Errorf("unknown archive format")}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, 0, err
+	}
+	return f, format, fi.Size(), nil
+}
+
+// Test fully reads a Tar/Gzip or Zip archive file without extracting it in order to check its integrity.
+// The archive format is detected from the file content, not its extension.
+// It returns an `*archive.CorruptError` describing the first corrupt entry and its offset if the archive is corrupt.
+func Test(path string) error {
+	f, format, size, err := openArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if format == ArchiveFormatZip {
+		return archive.TestZipballBytes(f, size)
+	}
+	return archive.TestTarballBytes(f)
+}
+
+// ReadGzipHeader reads the Gzip header metadata of a Tar/Gzip archive file like its original name, comment and modification time.
+// It only reads the beginning of the file and returns an error for other archive formats.
+func ReadGzipHeader(path string) (*archive.GzipHeader, error) {
+	f, format, _, err := openArchiveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if format != ArchiveFormatTar {
+		return nil, fmt.Errorf("%s is not a Tar/Gzip archive", path)
+	}
+	return archive.ReadGzipHeader(f)
+}
+
+// Extract unpacks a Tar/Gzip or Zip archive file (src) into the dst directory enforcing reading limits (e.g. `archive.DefaultLimits()`) while streaming.
+// The archive format is detected from the file content, not its extension.
+// It returns an `*archive.LimitError` as soon as a limit is crossed.
+func Extract(src string, dst string, limits archive.Limits) error {
+	return ExtractWithOptions(src, dst, limits, archive.ExtractOptions{})
+}
+
+// ExtractWithOptions unpacks a Tar/Gzip or Zip archive file (src) into the dst directory like `Extract` with the given options
+// like restoring extended attributes.
+func ExtractWithOptions(src string, dst string, limits archive.Limits, opts archive.ExtractOptions) error {
+	f, format, size, err := openArchiveFile(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r *archive.Reader
+	if format == ArchiveFormatZip {
+		r, err = archive.NewZipballReader(f, size, limits)
+	} else {
+		r, err = archive.NewTarballReader(f, limits)
+	}
 	if err != nil {
-		return "", fmt.Errorf("can't create checksum(s): %s", err)
+		return err
 	}
-	return files[0], nil
+	return r.ExtractWithOptions(dst, opts)
 }
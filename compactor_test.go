@@ -3,7 +3,16 @@
 package compactor
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/joseluisq/compactor/pkg/archive"
+	"github.com/joseluisq/compactor/pkg/checksum"
 )
 
 func Test_createArchiveFile(t *testing.T) {
@@ -61,9 +70,13 @@ func Test_createArchiveFile(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := createArchiveFile(tt.args.basePath, tt.args.src, tt.args.dst, tt.args.format); (err != nil) != tt.wantErr {
+			if err := createArchiveFile(tt.args.basePath, tt.args.src, tt.args.dst, tt.args.format, archiveOptions{}); (err != nil) != tt.wantErr {
 				t.Errorf("createArchiveFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			// The default destination is written to the working directory
+			if tt.args.dst == "" {
+				os.Remove("file.txt.zip")
+			}
 		})
 	}
 }
@@ -257,3 +270,277 @@ func TestCreateZipballWithChecksum(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateArchiveWithChecksums(t *testing.T) {
+	type args struct {
+		basePath      string
+		src           string
+		dst           string
+		checksumAlgos []string
+		checksumDst   string
+	}
+	tests := []struct {
+		name       string
+		create     func(string, string, string, []string, string) (*ArchiveResult, error)
+		args       args
+		wantFile   string
+		wantChecks []string
+		wantErr    bool
+	}{
+		{
+			name:   "tar/gz file with several checksums",
+			create: CreateTarballWithChecksums,
+			args: args{
+				src:           "pkg/archive/fixtures/file.txt",
+				dst:           "/tmp/file-multi",
+				checksumAlgos: []string{"sha256", "md5"},
+				checksumDst:   "/tmp/file-multi.CHECKSUM.tar.txt",
+			},
+			wantFile:   "/tmp/file-multi.tar.gz",
+			wantChecks: []string{"/tmp/file-multi.sha256.tar.txt", "/tmp/file-multi.md5.tar.txt"},
+		},
+		{
+			name:   "zip file with several checksums",
+			create: CreateZipballWithChecksums,
+			args: args{
+				basePath:      "pkg/archive",
+				src:           "fixtures",
+				dst:           "/tmp/file-multi.zip",
+				checksumAlgos: []string{"sha1", "sha512"},
+				checksumDst:   "/tmp/file-multi.CHECKSUM.zip.txt",
+			},
+			wantFile:   "/tmp/file-multi.zip",
+			wantChecks: []string{"/tmp/file-multi.sha1.zip.txt", "/tmp/file-multi.sha512.zip.txt"},
+		},
+		{
+			name:   "invalid algorithm before archiving",
+			create: CreateZipballWithChecksums,
+			args: args{
+				src:           "pkg/archive/fixtures/file.txt",
+				dst:           "/tmp/file-invalid-algo.zip",
+				checksumAlgos: []string{"sha256", "sha11"},
+				checksumDst:   "/tmp/file-invalid-algo.CHECKSUM.zip.txt",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.create(tt.args.basePath, tt.args.src, tt.args.dst, tt.args.checksumAlgos, tt.args.checksumDst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createArchiveFileWithChecksums() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(tt.args.dst); !os.IsNotExist(err) {
+					t.Errorf("createArchiveFileWithChecksums() archive %v should not exist", tt.args.dst)
+				}
+				return
+			}
+			if got.File != tt.wantFile {
+				t.Errorf("createArchiveFileWithChecksums() file = %v, want %v", got.File, tt.wantFile)
+			}
+			if !reflect.DeepEqual(got.ChecksumFiles, tt.wantChecks) {
+				t.Errorf("createArchiveFileWithChecksums() checksum files = %v, want %v", got.ChecksumFiles, tt.wantChecks)
+			}
+			for i, algo := range tt.args.checksumAlgos {
+				f, err := os.Open(got.File)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				want, err := checksum.ComputeChecksum(f, algo)
+				f.Close()
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				if got.Checksums[algo] != want {
+					t.Errorf("createArchiveFileWithChecksums() %s = %v, want %v", algo, got.Checksums[algo], want)
+				}
+				data, err := ioutil.ReadFile(got.ChecksumFiles[i])
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				line := want + "  " + filepath.Base(got.File) + "\n"
+				if string(data) != line {
+					t.Errorf("createArchiveFileWithChecksums() checksum file = %q, want %q", data, line)
+				}
+			}
+		})
+	}
+}
+
+func TestTest(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	tarball := filepath.Join(tmpDirPath, "fixtures.tar.gz")
+	if err := CreateTarball("", "pkg/archive/fixtures", tarball); err != nil {
+		t.Fatalf("%v", err)
+	}
+	zipball := filepath.Join(tmpDirPath, "fixtures.zip")
+	if err := CreateZipball("", "pkg/archive/fixtures", zipball); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Corrupt the Gzip CRC-32 trailer of a tarball copy
+	corrupted := filepath.Join(tmpDirPath, "corrupted.tar.gz")
+	data, err := ioutil.ReadFile(tarball)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	data[len(data)-8] ^= 0xff
+	if err := ioutil.WriteFile(corrupted, data, 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	unknown := filepath.Join(tmpDirPath, "file.txt")
+	if err := ioutil.WriteFile(unknown, []byte("not an archive"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantErr     bool
+		wantCorrupt bool
+	}{
+		{name: "valid tarball", path: tarball},
+		{name: "valid zipball", path: zipball},
+		{name: "corrupted tarball", path: corrupted, wantErr: true, wantCorrupt: true},
+		{name: "unknown archive format", path: unknown, wantErr: true, wantCorrupt: true},
+		{name: "missing file", path: filepath.Join(tmpDirPath, "missing.zip"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Test(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Test() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var cerr *archive.CorruptError
+			if errors.As(err, &cerr) != tt.wantCorrupt {
+				t.Errorf("Test() error = %v, wantCorrupt %v", err, tt.wantCorrupt)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	want, err := ioutil.ReadFile("pkg/archive/fixtures/file.txt")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, ext := range []string{"tar.gz", "zip"} {
+		t.Run(ext, func(t *testing.T) {
+			src := filepath.Join(tmpDirPath, "fixtures."+ext)
+			if ext == "zip" {
+				err = CreateZipball("pkg/archive", "fixtures", src)
+			} else {
+				err = CreateTarball("pkg/archive", "fixtures", src)
+			}
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dst := filepath.Join(tmpDirPath, ext)
+			if err := Extract(src, dst, archive.DefaultLimits()); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			got, err := ioutil.ReadFile(filepath.Join(dst, "fixtures", "file.txt"))
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("Extract() fixtures/file.txt = %d bytes, %v, want %d bytes", len(got), err, len(want))
+			}
+			var lerr *archive.LimitError
+			if err := Extract(src, dst+"-limited", archive.Limits{MaxEntrySize: 1}); !errors.As(err, &lerr) {
+				t.Errorf("Extract() error = %v, want *archive.LimitError", err)
+			}
+		})
+	}
+}
+
+func TestReadGzipHeader(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	header := archive.GzipHeader{Name: "fixtures.tar", Comment: "build 42", ModTime: time.Unix(1600000000, 0), OS: 3}
+	tarball := filepath.Join(tmpDirPath, "fixtures.tar.gz")
+	if err := CreateTarballWithOptions("pkg/archive", "fixtures", tarball, archive.TarOptions{Gzip: header}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	zipball := filepath.Join(tmpDirPath, "fixtures.zip")
+	if err := CreateZipball("pkg/archive", "fixtures", zipball); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *archive.GzipHeader
+		wantErr bool
+	}{
+		{name: "tarball", path: tarball, want: &header},
+		{name: "zipball", path: zipball, wantErr: true},
+		{name: "missing file", path: filepath.Join(tmpDirPath, "missing.tar.gz"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadGzipHeader(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadGzipHeader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadGzipHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateArchiveInsideSource(t *testing.T) {
+	for _, ext := range []string{"tar.gz", "zip"} {
+		t.Run(ext, func(t *testing.T) {
+			tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer os.RemoveAll(tmpDirPath)
+			src := filepath.Join(tmpDirPath, "src")
+			if err := os.MkdirAll(filepath.Join(src, "dist"), 0755); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("hello"), 0644); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			// The archive being written is part of the walked tree
+			dst := filepath.Join(src, "dist", "src."+ext)
+			if ext == "zip" {
+				err = CreateZipball(tmpDirPath, "src", dst)
+			} else {
+				err = CreateTarball(tmpDirPath, "src", dst)
+			}
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			out := filepath.Join(tmpDirPath, "out")
+			if err := Extract(dst, out, archive.DefaultLimits()); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if got, err := ioutil.ReadFile(filepath.Join(out, "src", "file.txt")); err != nil || string(got) != "hello" {
+				t.Errorf("Extract() src/file.txt = %q, %v, want %q", got, err, "hello")
+			}
+			if _, err := os.Lstat(filepath.Join(out, "src", "dist", "src."+ext)); !os.IsNotExist(err) {
+				t.Errorf("archive contains itself, error = %v", err)
+			}
+		})
+	}
+}
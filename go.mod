@@ -1,3 +1,9 @@
 module github.com/joseluisq/compactor
 
 go 1.15
+
+require (
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
+	golang.org/x/text v0.3.6
+)
@@ -0,0 +1,262 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned when an entry path or link target escapes the extraction directory.
+var ErrUnsafePath = errors.New("archive: unsafe entry path")
+
+// ExtractOptions represents the archive extraction options.
+type ExtractOptions struct {
+	// Xattrs restores the extended attributes stored as PAX `SCHILY.xattr.*` records.
+	// Attributes which can't be set due to missing privileges or file system support are skipped. Only supported on Linux.
+	Xattrs bool
+}
+
+// Extract unpacks the remaining archive entries into the dst directory enforcing the reader limits while streaming.
+// Entries escaping dst (absolute paths, `..` components, writing through links resolving outside) are rejected
+// as well as symbolic links resolving outside dst once the links already extracted are followed
+// and hard links to anything but regular files or to files reached through such links.
+// A file crossing a limit is removed and the `*LimitError` is returned without writing the remaining data.
+func (r *Reader) Extract(dst string) error {
+	return r.ExtractWithOptions(dst, ExtractOptions{})
+}
+
+// ExtractWithOptions unpacks the remaining archive entries into the dst directory like `Extract` with the given options.
+func (r *Reader) ExtractWithOptions(dst string, opts ExtractOptions) error {
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	if dst, err = filepath.EvalSymlinks(dst); err != nil {
+		return err
+	}
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.extractEntry(dst, e, &opts); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Reader) extractEntry(dst string, e *Entry, opts *ExtractOptions) error {
+	target, err := safeJoin(dst, e.Name)
+	if err != nil {
+		return err
+	}
+	if target == dst {
+		return nil
+	}
+	// Parent directories must not be redirected outside by previously extracted symbolic links
+	if err := mkdirInside(dst, filepath.Dir(target), e.Name); err != nil {
+		return err
+	}
+
+	switch {
+	case e.Mode.IsDir():
+		if err := os.MkdirAll(target, e.Mode.Perm()|0700); err != nil {
+			return err
+		}
+	case e.Mode&os.ModeSymlink != 0:
+		if err := checkLinkTarget(dst, target, e.Linkname); err != nil {
+			return fmt.Errorf("%w: %q links to %q", err, e.Name, e.Linkname)
+		}
+		if err := os.Symlink(e.Linkname, target); err != nil {
+			return err
+		}
+	case e.Tar != nil && e.Tar.Typeflag == tar.TypeLink:
+		source, err := safeJoin(dst, e.Linkname)
+		if err != nil {
+			return err
+		}
+		// The source must not be reached through symbolic links resolving outside
+		if err := checkInside(dst, filepath.Dir(source), e.Name); err != nil {
+			return err
+		}
+		// Linking a symbolic link copies it as is, so its target would be resolved from the new location
+		fi, err := os.Lstat(source)
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("%w: %q links to %q which is not a regular file", ErrUnsafePath, e.Name, e.Linkname)
+		}
+		if err := os.Link(source, target); err != nil {
+			return err
+		}
+	case e.Mode.IsRegular():
+		if err := r.extractFile(target, e); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	// Attributes like file capabilities are set last since writing a file clears them
+	if opts.Xattrs && e.Tar != nil {
+		if err := restoreXattrs(target, e.Tar.PAXRecords); err != nil {
+			return fmt.Errorf("archive: can't restore extended attributes of %q: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// restoreXattrs sets the extended attributes stored in PAX records skipping the ones not permitted.
+func restoreXattrs(target string, records map[string]string) error {
+	for key, value := range records {
+		if !strings.HasPrefix(key, xattrPAXPrefix) {
+			continue
+		}
+		err := writeXattr(target, strings.TrimPrefix(key, xattrPAXPrefix), value)
+		if err != nil && !isXattrNotPermitted(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the current entry data into a new file which is removed on error.
+func (r *Reader) extractFile(target string, e *Entry) error {
+	// O_EXCL never follows an existing symbolic link
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, e.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	if e.Tar != nil && isSparseTar(e.Tar) {
+		err = copySparse(f, r, e.Size)
+	} else {
+		_, err = io.Copy(f, r)
+	}
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Chtimes(target, e.ModTime, e.ModTime)
+}
+
+// safeJoin joins a slash-separated entry name to the dst directory rejecting names escaping it.
+func safeJoin(dst string, name string) (string, error) {
+	p := filepath.FromSlash(name)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	target := filepath.Join(dst, p)
+	if !isInside(dst, target) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return target, nil
+}
+
+// mkdirInside creates the missing directories of dir one by one
+// checking that existing symbolic links resolve inside dst before going through them.
+func mkdirInside(dst string, dir string, name string) error {
+	rel, err := filepath.Rel(dst, dir)
+	if err != nil {
+		return err
+	}
+	cur := dst
+	for _, p := range strings.Split(rel, string(filepath.Separator)) {
+		if p == "." {
+			continue
+		}
+		cur = filepath.Join(cur, p)
+		fi, err := os.Lstat(cur)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(cur, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case fi.Mode()&os.ModeSymlink != 0:
+			if err := checkInside(dst, cur, name); err != nil {
+				return err
+			}
+		case !fi.IsDir():
+			return fmt.Errorf("archive: %q parent %s is not a directory", name, cur)
+		}
+	}
+	return nil
+}
+
+// checkLinkTarget checks that a symbolic link target resolves inside dst.
+// Targets may only go up with leading `..` components, applied to the resolved link directory, and then go down.
+// Since every extracted link is checked this way, going down through them never leaves dst
+// and the links not created by the extraction are resolved.
+// Targets like `d/y/..` are rejected because `d/y` may be a link itself.
+func checkLinkTarget(dst string, target string, linkname string) error {
+	if linkname == "" || filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return ErrUnsafePath
+	}
+	p, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	down := false
+	for _, c := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch c {
+		case "", ".":
+		case "..":
+			if down || p == dst {
+				return ErrUnsafePath
+			}
+			p = filepath.Dir(p)
+		default:
+			down = true
+			p = filepath.Join(p, c)
+		}
+	}
+	if !isInside(dst, p) {
+		return ErrUnsafePath
+	}
+	// Links found in dst before the extraction aren't checked, so the existing part of the target is resolved too
+	for existing := p; existing != dst; existing = filepath.Dir(existing) {
+		if _, err := os.Lstat(existing); err != nil {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err != nil {
+			return err
+		}
+		if !isInside(dst, resolved) {
+			return ErrUnsafePath
+		}
+		break
+	}
+	return nil
+}
+
+// checkInside checks that a directory resolves inside dst once its symbolic links are evaluated.
+func checkInside(dst string, dir string, name string) error {
+	p, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !isInside(dst, p) {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return nil
+}
+
+// isInside reports whether a clean path is dst or inside it.
+func isInside(dst string, p string) bool {
+	return p == dst || strings.HasPrefix(p, dst+string(filepath.Separator))
+}
@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReaderExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []testEntry
+		limits    Limits
+		wantErr   error
+		wantFiles map[string]string
+		noFiles   []string
+	}{
+		{
+			name: "files directories and links",
+			entries: []testEntry{
+				{name: "dir/", typ: tar.TypeDir, mode: 0755},
+				{name: "dir/file.txt", body: "hello"},
+				{name: "dir/exec.sh", body: "#!/bin/sh", mode: 0755},
+				{name: "dir/link.txt", typ: tar.TypeSymlink, link: "file.txt"},
+			},
+			wantFiles: map[string]string{"dir/file.txt": "hello", "dir/link.txt": "hello", "dir/exec.sh": "#!/bin/sh"},
+		},
+		{
+			name:    "parent directory traversal",
+			entries: []testEntry{{name: "../evil.txt", body: "evil"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/tmp/evil.txt", body: "evil"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "symbolic link pointing outside",
+			entries: []testEntry{{name: "link", typ: tar.TypeSymlink, link: "../../etc"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "symbolic link with absolute target",
+			entries: []testEntry{{name: "link", typ: tar.TypeSymlink, link: "/etc"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name: "entry crossing a limit is removed",
+			entries: []testEntry{
+				{name: "ok.txt", body: "ok"},
+				{name: "zeros", body: strings.Repeat("\x00", 8<<20)},
+			},
+			limits:    Limits{MaxCompressionRatio: 100},
+			wantErr:   &LimitError{Limit: LimitCompressionRatio, Entry: "zeros", Max: 100},
+			wantFiles: map[string]string{"ok.txt": "ok"},
+			noFiles:   []string{"zeros"},
+		},
+	}
+	for _, format := range []string{"tar", "zip"} {
+		for _, tt := range tests {
+			t.Run(format+" "+tt.name, func(t *testing.T) {
+				tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				defer os.RemoveAll(tmpDirPath)
+				dst := filepath.Join(tmpDirPath, "dst")
+
+				r, err := newTestReader(t, format, tt.entries, tt.limits)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				err = r.Extract(dst)
+				var lerr *LimitError
+				switch want := tt.wantErr.(type) {
+				case nil:
+					if err != nil {
+						t.Fatalf("Extract() error = %v", err)
+					}
+				case *LimitError:
+					if !errors.As(err, &lerr) || *lerr != *want {
+						t.Fatalf("Extract() error = %v, want %v", err, want)
+					}
+				default:
+					if !errors.Is(err, want) {
+						t.Fatalf("Extract() error = %v, want %v", err, want)
+					}
+				}
+				for name, want := range tt.wantFiles {
+					got, err := ioutil.ReadFile(filepath.Join(dst, name))
+					if err != nil || string(got) != want {
+						t.Errorf("Extract() %s = %q, %v, want %q", name, got, err, want)
+					}
+				}
+				for _, name := range tt.noFiles {
+					if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+						t.Errorf("Extract() %s exists, error = %v", name, err)
+					}
+				}
+				if _, err := os.Lstat(filepath.Join(tmpDirPath, "evil.txt")); !os.IsNotExist(err) {
+					t.Errorf("Extract() wrote outside of dst")
+				}
+			})
+		}
+	}
+}
+
+func TestReaderExtractThroughSymlink(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	outside := filepath.Join(tmpDirPath, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	dst := filepath.Join(tmpDirPath, "dst")
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	// A link left in the destination directory must not be written through
+	if err := os.Symlink(outside, filepath.Join(dst, "link")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	data := testTarball(t, []testEntry{{name: "link/sub/evil.txt", body: "evil"}})
+	r, err := NewTarballReader(bytes.NewReader(data), Limits{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := r.Extract(dst); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Extract() error = %v, want %v", err, ErrUnsafePath)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "sub")); !os.IsNotExist(err) {
+		t.Errorf("Extract() created a directory outside of dst")
+	}
+}
+
+func TestReaderExtractLinkChains(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []testEntry
+		wantErr   error
+		wantFiles map[string]string
+		noFiles   []string
+	}{
+		{
+			name: "symbolic link going up through an extracted link",
+			entries: []testEntry{
+				{name: "d/", typ: tar.TypeDir, mode: 0755},
+				{name: "d/y", typ: tar.TypeSymlink, link: ".."},
+				{name: "x", typ: tar.TypeSymlink, link: "d/y/.."},
+				{name: "h", typ: tar.TypeLink, link: "x/secret"},
+			},
+			wantErr: ErrUnsafePath,
+			noFiles: []string{"x", "h"},
+		},
+		{
+			name: "hard link to a symbolic link going up",
+			entries: []testEntry{
+				{name: "d/", typ: tar.TypeDir, mode: 0755},
+				{name: "d/l", typ: tar.TypeSymlink, link: "../x"},
+				{name: "l2", typ: tar.TypeLink, link: "d/l"},
+			},
+			wantErr: ErrUnsafePath,
+			noFiles: []string{"l2"},
+		},
+		{
+			name:    "hard link through a link found in dst",
+			entries: []testEntry{{name: "h", typ: tar.TypeLink, link: "outside/secret"}},
+			wantErr: ErrUnsafePath,
+			noFiles: []string{"h"},
+		},
+		{
+			name:    "symbolic link through a link found in dst",
+			entries: []testEntry{{name: "s", typ: tar.TypeSymlink, link: "outside/secret"}},
+			wantErr: ErrUnsafePath,
+			noFiles: []string{"s"},
+		},
+		{
+			name: "links resolving inside",
+			entries: []testEntry{
+				{name: "lib/", typ: tar.TypeDir, mode: 0755},
+				{name: "lib/libc.so", body: "libc"},
+				{name: "lib64", typ: tar.TypeSymlink, link: "lib"},
+				{name: "bin/", typ: tar.TypeDir, mode: 0755},
+				{name: "bin/libc.so", typ: tar.TypeSymlink, link: "../lib64/./libc.so"},
+				{name: "libc.so", typ: tar.TypeLink, link: "lib64/libc.so"},
+			},
+			wantFiles: map[string]string{"bin/libc.so": "libc", "libc.so": "libc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer os.RemoveAll(tmpDirPath)
+			outside := filepath.Join(tmpDirPath, "outside")
+			if err := os.Mkdir(outside, 0755); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+				t.Fatalf("%v", err)
+			}
+			dst := filepath.Join(tmpDirPath, "dst")
+			if err := os.Mkdir(dst, 0755); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := os.Symlink(outside, filepath.Join(dst, "outside")); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			r, err := NewTarballReader(bytes.NewReader(testTarball(t, tt.entries)), Limits{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			err = r.Extract(dst)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Extract() error = %v, want %v", err, tt.wantErr)
+			}
+			for name, want := range tt.wantFiles {
+				got, err := ioutil.ReadFile(filepath.Join(dst, name))
+				if err != nil || string(got) != want {
+					t.Errorf("Extract() %s = %q, %v, want %q", name, got, err, want)
+				}
+			}
+			for _, name := range tt.noFiles {
+				if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+					t.Errorf("Extract() %s exists, error = %v", name, err)
+				}
+			}
+			if _, err := os.Lstat(filepath.Join(tmpDirPath, "h")); !os.IsNotExist(err) {
+				t.Errorf("Extract() wrote outside of dst")
+			}
+		})
+	}
+}
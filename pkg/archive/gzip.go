@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// gzipOSUnknown is the Gzip header operating system id written by default.
+const gzipOSUnknown = 255
+
+// GzipHeader represents the Gzip header metadata of a tarball like the build which produced it.
+type GzipHeader struct {
+	// Name is the original file name (e.g. `my-archive.tar`). It's limited to ISO 8859-1 characters.
+	Name string
+	// Comment is a free text (e.g. a build id or Git commit). It's limited to ISO 8859-1 characters.
+	Comment string
+	// ModTime is the modification time with a one-second precision. The zero value stores none.
+	ModTime time.Time
+	// OS is the operating system id (e.g. 3 for Unix or 11 for NTFS).
+	// The zero value stores 255 (unknown) like `gzip.NewWriter` so FAT (0) can't be stored.
+	OS byte
+}
+
+// validate checks that the header can be represented in Gzip.
+func (h *GzipHeader) validate() error {
+	for _, s := range []string{h.Name, h.Comment} {
+		for _, c := range s {
+			if c == 0 || c > 0xff {
+				return fmt.Errorf("compress/gzip: header string %q is not ISO 8859-1 without NUL characters", s)
+			}
+		}
+	}
+	if !h.ModTime.IsZero() && (h.ModTime.Unix() <= 0 || h.ModTime.Unix() > math.MaxUint32) {
+		return fmt.Errorf("compress/gzip: modification time %v out of range", h.ModTime)
+	}
+	return nil
+}
+
+// apply sets the header of a Gzip writer before anything is written.
+func (h *GzipHeader) apply(zw *gzip.Writer) {
+	zw.Name = h.Name
+	zw.Comment = h.Comment
+	zw.ModTime = h.ModTime
+	zw.OS = h.OS
+	if zw.OS == 0 {
+		zw.OS = gzipOSUnknown
+	}
+}
+
+// newGzipHeader copies the header read by a Gzip reader.
+func newGzipHeader(zr *gzip.Reader) *GzipHeader {
+	return &GzipHeader{
+		Name:    zr.Name,
+		Comment: zr.Comment,
+		ModTime: zr.ModTime,
+		OS:      zr.OS,
+	}
+}
+
+// ReadGzipHeader reads the Gzip header of a tarball without reading its content.
+func ReadGzipHeader(r io.Reader) (*GzipHeader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return newGzipHeader(zr), nil
+}
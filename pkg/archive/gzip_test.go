@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGzipHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  GzipHeader
+		want    GzipHeader
+		wantErr bool
+	}{
+		{
+			name: "default header",
+			want: GzipHeader{OS: 255},
+		},
+		{
+			name: "build metadata",
+			header: GzipHeader{
+				Name:    "release.tar",
+				Comment: "build 42 (commit 365efde)",
+				ModTime: time.Unix(1600000000, 999),
+				OS:      3,
+			},
+			want: GzipHeader{
+				Name:    "release.tar",
+				Comment: "build 42 (commit 365efde)",
+				ModTime: time.Unix(1600000000, 0),
+				OS:      3,
+			},
+		},
+		{
+			name:   "latin-1 name",
+			header: GzipHeader{Name: "café.tar"},
+			want:   GzipHeader{Name: "café.tar", OS: 255},
+		},
+		{
+			name:    "non latin-1 comment",
+			header:  GzipHeader{Comment: "ビルド"},
+			wantErr: true,
+		},
+		{
+			name:    "nul name",
+			header:  GzipHeader{Name: "a\x00b"},
+			wantErr: true,
+		},
+		{
+			name:    "modification time before 1970",
+			header:  GzipHeader{ModTime: time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outBuf := &bytes.Buffer{}
+			err := CreateTarballBytesWithOptions("", "fixtures", outBuf, TarOptions{Gzip: tt.header})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTarballBytesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			data := outBuf.Bytes()
+			got, err := ReadGzipHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ReadGzipHeader() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ReadGzipHeader() = %+v, want %+v", *got, tt.want)
+			}
+			r, err := NewTarballReader(bytes.NewReader(data), Limits{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if got := r.GzipHeader(); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Reader.GzipHeader() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
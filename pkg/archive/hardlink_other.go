@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package archive
+
+import "os"
+
+// hardlinkID never detects hard links on platforms without inode numbers.
+func hardlinkID(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,313 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const tarBlockSize = 512
+
+// ErrMissingEndMarker is returned when a Tar stream ends without its two zero blocks end-of-archive marker.
+var ErrMissingEndMarker = errors.New("archive/tar: missing end-of-archive marker")
+
+// CorruptError describes the first corrupt entry found when testing an archive.
+type CorruptError struct {
+	// Entry is the corrupt entry name or empty when the entry header itself or the whole archive is corrupt.
+	Entry string
+	// Offset is the byte offset of the corrupt entry header.
+	// For Tar/Gzip archives it's relative to the decompressed Tar stream.
+	Offset int64
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CorruptError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("corrupt archive at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("corrupt entry %q at offset %d: %v", e.Entry, e.Offset, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// TestTarballBytes fully reads a Tar/Gzip archive without extracting it.
+// It validates the Gzip CRC-32 and size trailers, Tar header checksums, entry sizes and the end-of-archive marker.
+// It returns a `*CorruptError` describing the first corrupt entry found.
+func TestTarballBytes(r io.Reader) error {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return &CorruptError{Err: err}
+	}
+	defer zr.Close()
+	cr := &countingReader{r: zr}
+	tr := tar.NewReader(cr)
+	for {
+		// Entry data is fully consumed so the next header starts at the next block
+		offset := (cr.n + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+		h, err := tr.Next()
+		if err == io.EOF {
+			// Two zero blocks must follow the last entry
+			if cr.n-offset != 2*tarBlockSize {
+				return &CorruptError{Offset: offset, Err: ErrMissingEndMarker}
+			}
+			break
+		}
+		if err != nil {
+			return &CorruptError{Offset: offset, Err: err}
+		}
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return &CorruptError{Entry: h.Name, Offset: offset, Err: err}
+		}
+	}
+	// Gzip trailers are only checked once the compressed stream is fully read
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return &CorruptError{Offset: cr.n, Err: err}
+	}
+	return nil
+}
+
+// TestZipballBytes fully reads a Zip archive of the given size without extracting it.
+// It validates the central directory, every local file header against its central directory record,
+// and every entry CRC-32 and sizes.
+// It returns a `*CorruptError` describing the first corrupt entry found.
+func TestZipballBytes(r io.ReaderAt, size int64) error {
+	entries, err := readZipCentralDirectory(r, size)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return &CorruptError{Err: err}
+	}
+	if len(zr.File) != len(entries) {
+		return &CorruptError{Err: fmt.Errorf("central directory has %d entries, want %d", len(zr.File), len(entries))}
+	}
+	for i, f := range zr.File {
+		e := entries[i]
+		if err := checkZipLocalHeader(r, e); err != nil {
+			return &CorruptError{Entry: e.name, Offset: e.offset, Err: err}
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return &CorruptError{Entry: e.name, Offset: e.offset, Err: err}
+		}
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return &CorruptError{Entry: e.name, Offset: e.offset, Err: err}
+		}
+	}
+	return nil
+}
+
+const (
+	zipLocalHeaderSig    = 0x04034b50
+	zipCentralHeaderSig  = 0x02014b50
+	zipEndSig            = 0x06054b50
+	zipEnd64LocatorSig   = 0x07064b50
+	zipEnd64Sig          = 0x06064b50
+	zipLocalHeaderLen    = 30
+	zipCentralHeaderLen  = 46
+	zipEndLen            = 22
+	zipEnd64LocatorLen   = 20
+	zipEnd64Len          = 56
+	zip64ExtraID         = 0x0001
+	zipDataDescriptorBit = 0x8
+	uint16max            = 0xffff
+	uint32max            = 0xffffffff
+)
+
+// zipEntry is a central directory record as needed to check its local file header.
+type zipEntry struct {
+	name   string
+	flags  uint16
+	crc32  uint32
+	csize  uint64
+	usize  uint64
+	offset int64
+}
+
+// readZipCentralDirectory reads the central directory records in archive order including Zip64 ones.
+func readZipCentralDirectory(r io.ReaderAt, size int64) ([]zipEntry, error) {
+	endOffset, end, err := findZipEnd(r, size)
+	if err != nil {
+		return nil, err
+	}
+	count := uint64(binary.LittleEndian.Uint16(end[10:]))
+	dirSize := uint64(binary.LittleEndian.Uint32(end[12:]))
+	dirOffset := uint64(binary.LittleEndian.Uint32(end[16:]))
+	if count == uint16max || dirSize == uint32max || dirOffset == uint32max {
+		count, dirSize, dirOffset, err = readZip64End(r, endOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dirOffset+dirSize > uint64(size) {
+		return nil, &CorruptError{Offset: endOffset, Err: errors.New("central directory out of bounds")}
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(r, int64(dirOffset), int64(dirSize)))
+	pos := int64(dirOffset)
+	var entries []zipEntry
+	buf := make([]byte, zipCentralHeaderLen)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, &CorruptError{Offset: pos, Err: err}
+		}
+		if binary.LittleEndian.Uint32(buf) != zipCentralHeaderSig {
+			return nil, &CorruptError{Offset: pos, Err: zip.ErrFormat}
+		}
+		e := zipEntry{
+			flags:  binary.LittleEndian.Uint16(buf[8:]),
+			crc32:  binary.LittleEndian.Uint32(buf[16:]),
+			csize:  uint64(binary.LittleEndian.Uint32(buf[20:])),
+			usize:  uint64(binary.LittleEndian.Uint32(buf[24:])),
+			offset: int64(binary.LittleEndian.Uint32(buf[42:])),
+		}
+		nameLen := int(binary.LittleEndian.Uint16(buf[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(buf[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(buf[32:]))
+		vars := make([]byte, nameLen+extraLen+commentLen)
+		if _, err := io.ReadFull(br, vars); err != nil {
+			return nil, &CorruptError{Offset: pos, Err: err}
+		}
+		e.name = string(vars[:nameLen])
+		offset := uint64(e.offset)
+		readZip64Extra(vars[nameLen:nameLen+extraLen], &e.usize, &e.csize, &offset)
+		if offset >= uint64(size) {
+			return nil, &CorruptError{Entry: e.name, Offset: pos, Err: errors.New("local file header out of bounds")}
+		}
+		e.offset = int64(offset)
+		entries = append(entries, e)
+		pos += int64(zipCentralHeaderLen + len(vars))
+	}
+	return entries, nil
+}
+
+// findZipEnd locates the end of central directory record which may be followed by an archive comment.
+func findZipEnd(r io.ReaderAt, size int64) (int64, []byte, error) {
+	n := int64(zipEndLen + uint16max)
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return 0, nil, &CorruptError{Err: err}
+	}
+	for i := len(buf) - zipEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != zipEndSig {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(buf[i+20:]))
+		if i+zipEndLen+commentLen <= len(buf) {
+			return size - n + int64(i), buf[i : i+zipEndLen], nil
+		}
+	}
+	return 0, nil, &CorruptError{Offset: size, Err: errors.New("end of central directory record not found")}
+}
+
+// readZip64End reads the Zip64 end of central directory record pointed by the locator preceding the end record.
+func readZip64End(r io.ReaderAt, endOffset int64) (count, dirSize, dirOffset uint64, err error) {
+	locOffset := endOffset - zipEnd64LocatorLen
+	loc := make([]byte, zipEnd64LocatorLen)
+	if locOffset < 0 {
+		return 0, 0, 0, &CorruptError{Offset: endOffset, Err: errors.New("missing Zip64 end of central directory locator")}
+	}
+	if _, err := r.ReadAt(loc, locOffset); err != nil || binary.LittleEndian.Uint32(loc) != zipEnd64LocatorSig {
+		return 0, 0, 0, &CorruptError{Offset: locOffset, Err: errors.New("missing Zip64 end of central directory locator")}
+	}
+	end64Offset := int64(binary.LittleEndian.Uint64(loc[8:]))
+	end := make([]byte, zipEnd64Len)
+	if end64Offset < 0 || end64Offset > locOffset {
+		return 0, 0, 0, &CorruptError{Offset: locOffset, Err: errors.New("out of bounds Zip64 end of central directory record")}
+	}
+	if _, err := r.ReadAt(end, end64Offset); err != nil || binary.LittleEndian.Uint32(end) != zipEnd64Sig {
+		return 0, 0, 0, &CorruptError{Offset: end64Offset, Err: errors.New("invalid Zip64 end of central directory record")}
+	}
+	return binary.LittleEndian.Uint64(end[32:]), binary.LittleEndian.Uint64(end[40:]), binary.LittleEndian.Uint64(end[48:]), nil
+}
+
+// readZip64Extra replaces the 32-bit sizes and offset which are saturated by their Zip64 extra field values.
+// The offset may be nil for local file headers.
+func readZip64Extra(extra []byte, usize, csize, offset *uint64) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if n > len(extra) {
+			return
+		}
+		if id == zip64ExtraID {
+			field := extra[:n]
+			for _, v := range []*uint64{usize, csize, offset} {
+				if v == nil || *v != uint32max {
+					continue
+				}
+				if len(field) < 8 {
+					return
+				}
+				*v = binary.LittleEndian.Uint64(field)
+				field = field[8:]
+			}
+			return
+		}
+		extra = extra[n:]
+	}
+}
+
+// checkZipLocalHeader checks a local file header against its central directory record.
+// CRC-32 and sizes are only stored in the local file header when no data descriptor follows the entry data.
+func checkZipLocalHeader(r io.ReaderAt, e zipEntry) error {
+	buf := make([]byte, zipLocalHeaderLen)
+	if _, err := r.ReadAt(buf, e.offset); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(buf) != zipLocalHeaderSig {
+		return errors.New("invalid local file header signature")
+	}
+	nameLen := int(binary.LittleEndian.Uint16(buf[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(buf[28:]))
+	vars := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(vars, e.offset+zipLocalHeaderLen); err != nil {
+		return err
+	}
+	if !bytes.Equal(vars[:nameLen], []byte(e.name)) {
+		return fmt.Errorf("local file header name %q does not match the central directory", vars[:nameLen])
+	}
+	if e.flags&zipDataDescriptorBit != 0 {
+		return nil
+	}
+	crc := binary.LittleEndian.Uint32(buf[14:])
+	csize := uint64(binary.LittleEndian.Uint32(buf[18:]))
+	usize := uint64(binary.LittleEndian.Uint32(buf[22:]))
+	readZip64Extra(vars[nameLen:], &usize, &csize, nil)
+	if crc != e.crc32 {
+		return fmt.Errorf("local file header CRC-32 %08x does not match the central directory %08x", crc, e.crc32)
+	}
+	if csize != e.csize || usize != e.usize {
+		return fmt.Errorf("local file header sizes %d/%d do not match the central directory %d/%d", csize, usize, e.csize, e.usize)
+	}
+	return nil
+}
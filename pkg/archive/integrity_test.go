@@ -0,0 +1,230 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+)
+
+// testTar returns an uncompressed Tar stream with two entries along with the second entry header offset.
+func testTar(t *testing.T, closed bool) ([]byte, int64) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	var offset int64
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if name == "b.txt" {
+			if err := tw.Flush(); err != nil {
+				t.Fatalf("%v", err)
+			}
+			offset = int64(buf.Len())
+		}
+		body := []byte("content of " + name + "\n")
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := tw.Write(body); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	var err error
+	if closed {
+		err = tw.Close()
+	} else {
+		err = tw.Flush()
+	}
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes(), offset
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTestTarballBytes(t *testing.T) {
+	valid, secondOffset := testTar(t, true)
+	unclosed, _ := testTar(t, false)
+	badHeader := append([]byte{}, valid...)
+	badHeader[secondOffset] = 'c'
+	badCRC := gzipBytes(t, valid)
+	badCRC[len(badCRC)-8] ^= 0xff
+	badSize := gzipBytes(t, valid)
+	badSize[len(badSize)-4] ^= 0xff
+	gzipped := gzipBytes(t, valid)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    error
+		wantEntry  string
+		wantOffset int64
+	}{
+		{
+			name: "valid archive",
+			data: gzipped,
+		},
+		{
+			name: "directory archive",
+			data: func() []byte {
+				buf := &bytes.Buffer{}
+				if err := CreateTarballBytes("", "./fixtures", buf); err != nil {
+					t.Fatalf("%v", err)
+				}
+				return buf.Bytes()
+			}(),
+		},
+		{
+			name:       "missing end-of-archive marker",
+			data:       gzipBytes(t, unclosed),
+			wantErr:    ErrMissingEndMarker,
+			wantOffset: int64(len(unclosed)),
+		},
+		{
+			name:       "tar header checksum mismatch",
+			data:       gzipBytes(t, badHeader),
+			wantErr:    tar.ErrHeader,
+			wantOffset: secondOffset,
+		},
+		{
+			name:       "gzip CRC-32 trailer mismatch",
+			data:       badCRC,
+			wantErr:    gzip.ErrChecksum,
+			wantOffset: int64(len(valid)),
+		},
+		{
+			name:       "gzip size trailer mismatch",
+			data:       badSize,
+			wantErr:    gzip.ErrChecksum,
+			wantOffset: int64(len(valid)),
+		},
+		{
+			name:      "truncated entry data",
+			data:      gzipBytes(t, valid[:secondOffset+tarBlockSize+4]),
+			wantErr:   errors.New("unexpected EOF"),
+			wantEntry: "b.txt",
+			// the entry header offset is reported
+			wantOffset: secondOffset,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TestTarballBytes(bytes.NewReader(tt.data))
+			checkCorruptError(t, err, tt.wantErr, tt.wantEntry, tt.wantOffset)
+		})
+	}
+}
+
+func TestTestZipballBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := w.Write([]byte("content of " + name + "\n")); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	valid := buf.Bytes()
+	entries, err := readZipCentralDirectory(bytes.NewReader(valid), int64(len(valid)))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("readZipCentralDirectory() = %v, %v", entries, err)
+	}
+	secondOffset := entries[1].offset
+	dataOffset := secondOffset + zipLocalHeaderLen + int64(len("b.txt"))
+
+	corrupt := func(f func(b []byte)) []byte {
+		b := append([]byte{}, valid...)
+		f(b)
+		return b
+	}
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    error
+		wantEntry  string
+		wantOffset int64
+	}{
+		{
+			name: "valid archive",
+			data: valid,
+		},
+		{
+			name: "directory archive",
+			data: func() []byte {
+				buf := &bytes.Buffer{}
+				if err := CreateZipballBytes("", "./fixtures", buf); err != nil {
+					t.Fatalf("%v", err)
+				}
+				return buf.Bytes()
+			}(),
+		},
+		{
+			name:       "entry data CRC-32 mismatch",
+			data:       corrupt(func(b []byte) { b[dataOffset] ^= 0xff }),
+			wantErr:    zip.ErrChecksum,
+			wantEntry:  "b.txt",
+			wantOffset: secondOffset,
+		},
+		{
+			name:       "local file header name mismatch",
+			data:       corrupt(func(b []byte) { b[secondOffset+zipLocalHeaderLen] = 'c' }),
+			wantErr:    errors.New(`local file header name "c.txt" does not match the central directory`),
+			wantEntry:  "b.txt",
+			wantOffset: secondOffset,
+		},
+		{
+			name:       "local file header signature",
+			data:       corrupt(func(b []byte) { b[secondOffset] = 'X' }),
+			wantErr:    errors.New("invalid local file header signature"),
+			wantEntry:  "b.txt",
+			wantOffset: secondOffset,
+		},
+		{
+			name:       "truncated archive",
+			data:       valid[:len(valid)-10],
+			wantErr:    errors.New("end of central directory record not found"),
+			wantOffset: int64(len(valid) - 10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TestZipballBytes(bytes.NewReader(tt.data), int64(len(tt.data)))
+			checkCorruptError(t, err, tt.wantErr, tt.wantEntry, tt.wantOffset)
+		})
+	}
+}
+
+func checkCorruptError(t *testing.T, err error, wantErr error, wantEntry string, wantOffset int64) {
+	t.Helper()
+	if wantErr == nil {
+		if err != nil {
+			t.Errorf("unexpected error = %v", err)
+		}
+		return
+	}
+	var cerr *CorruptError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("error = %v, want *CorruptError", err)
+	}
+	if cerr.Err.Error() != wantErr.Error() || cerr.Entry != wantEntry || cerr.Offset != wantOffset {
+		t.Errorf("error = %q (entry %q, offset %d), want %q (entry %q, offset %d)",
+			cerr.Err, cerr.Entry, cerr.Offset, wantErr, wantEntry, wantOffset)
+	}
+}
@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Override represents a rule overriding the mode, modification time or owner of the entries matching a glob pattern.
+// Zero value fields keep the entry values.
+type Override struct {
+	// Pattern is a `path.Match` glob matched against the slash-separated entry name as written in the archive.
+	// A pattern ending with a slash (e.g. `bin/`) matches a directory and everything under it
+	// and a pattern without slashes (e.g. `*.sh`) matches base names at any depth.
+	Pattern string
+	// Mode is the permission bits (including setuid, setgid and sticky bits) of matching regular files.
+	Mode os.FileMode
+	// DirMode is the permission bits of matching directories.
+	DirMode os.FileMode
+	// ModTime is the modification time of matching entries.
+	ModTime time.Time
+	// Owner is the ownership of matching entries. Zip entries only carry uids and gids with the UnixOwner option.
+	Owner *Owner
+}
+
+// Overrides is a list of override rules applied in order, so the last matching rule wins for each field.
+// Symbolic links are matched but their modes are never changed.
+type Overrides []Override
+
+// validate checks that every rule pattern is well-formed.
+func (o Overrides) validate() error {
+	for _, r := range o {
+		if err := validatePattern("override", r.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePattern checks that a kind of rule glob pattern is well-formed.
+func validatePattern(kind string, pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("archive: empty %s pattern", kind)
+	}
+	if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+		return fmt.Errorf("archive: invalid %s pattern %q: %s", kind, pattern, err)
+	}
+	return nil
+}
+
+// resolve merges the rules matching an entry name.
+func (o Overrides) resolve(name string) (r Override) {
+	name = strings.TrimSuffix(name, "/")
+	for _, rule := range o {
+		if !matchPattern(rule.Pattern, name) {
+			continue
+		}
+		if rule.Mode != 0 {
+			r.Mode = rule.Mode
+		}
+		if rule.DirMode != 0 {
+			r.DirMode = rule.DirMode
+		}
+		if !rule.ModTime.IsZero() {
+			r.ModTime = rule.ModTime
+		}
+		if rule.Owner != nil {
+			r.Owner = rule.Owner
+		}
+	}
+	return r
+}
+
+// matchPattern reports whether a slash-separated entry name matches an override pattern.
+func matchPattern(pattern string, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		// Match the directory itself or any of its parents
+		pattern = strings.TrimSuffix(pattern, "/")
+		parts := strings.Split(name, "/")
+		for i := range parts {
+			if ok, _ := path.Match(pattern, strings.Join(parts[:i+1], "/")); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// applyTar applies the rules matching a Tar header.
+func (o Overrides) applyTar(h *tar.Header) {
+	if len(o) == 0 {
+		return
+	}
+	r := o.resolve(h.Name)
+	switch {
+	case h.Typeflag == tar.TypeDir && r.DirMode != 0:
+		h.Mode = tarMode(r.DirMode)
+	case (h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeRegA) && r.Mode != 0:
+		h.Mode = tarMode(r.Mode)
+	}
+	if !r.ModTime.IsZero() {
+		h.ModTime = r.ModTime
+	}
+	if r.Owner != nil {
+		h.Uid, h.Gid = r.Owner.UID, r.Owner.GID
+		h.Uname, h.Gname = r.Owner.Uname, r.Owner.Gname
+	}
+}
+
+// applyZip applies the rules matching a Zip header.
+func (o Overrides) applyZip(h *zip.FileHeader) {
+	if len(o) == 0 {
+		return
+	}
+	r := o.resolve(h.Name)
+	mode := h.Mode()
+	switch {
+	case mode.IsDir() && r.DirMode != 0:
+		h.SetMode(mode&os.ModeType | permMode(r.DirMode))
+	case mode.IsRegular() && r.Mode != 0:
+		h.SetMode(permMode(r.Mode))
+	}
+	if !r.ModTime.IsZero() {
+		h.Modified = r.ModTime
+	}
+}
+
+// permMode keeps the permission, setuid, setgid and sticky bits of a mode.
+func permMode(m os.FileMode) os.FileMode {
+	return m & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// tarMode converts permission, setuid, setgid and sticky bits to Tar header mode bits.
+func tarMode(m os.FileMode) int64 {
+	mode := int64(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
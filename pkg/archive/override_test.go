@@ -0,0 +1,144 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_matchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "bin/", name: "bin", want: true},
+		{pattern: "bin/", name: "bin/cli", want: true},
+		{pattern: "bin/", name: "bin/sub/cli", want: true},
+		{pattern: "bin/", name: "sbin/cli", want: false},
+		{pattern: "*/bin/", name: "app/bin/cli", want: true},
+		{pattern: "*.sh", name: "scripts/deep/run.sh", want: true},
+		{pattern: "*.sh", name: "run.shx", want: false},
+		{pattern: "scripts/*.sh", name: "scripts/run.sh", want: true},
+		{pattern: "scripts/*.sh", name: "scripts/deep/run.sh", want: false},
+		{pattern: "*", name: "any/thing", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := matchPattern(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("matchPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateArchiveBytesWithOverrides(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// Checkout modes are all wrong on purpose
+	for _, name := range []string{"bin/cli", "secrets/key", "readme.txt"} {
+		p := filepath.Join(tmpDirPath, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0666); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := os.Symlink("bin/cli", filepath.Join(tmpDirPath, "src", "cli")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	overrides := Overrides{
+		{Pattern: "*", Mode: 0644, DirMode: 0755, ModTime: epoch},
+		{Pattern: "src/bin/", Mode: 0755},
+		{Pattern: "src/secrets/", Mode: 0600, DirMode: 0700, Owner: &Owner{UID: 1, GID: 1, Uname: "daemon", Gname: "daemon"}},
+	}
+	want := map[string]os.FileMode{
+		"src":             os.ModeDir | 0755,
+		"src/bin":         os.ModeDir | 0755,
+		"src/bin/cli":     0755,
+		"src/secrets":     os.ModeDir | 0700,
+		"src/secrets/key": 0600,
+		"src/readme.txt":  0644,
+		"src/cli":         os.ModeSymlink | 0777,
+	}
+
+	t.Run("tar", func(t *testing.T) {
+		outBuf := &bytes.Buffer{}
+		if err := CreateTarballBytesWithOptions(tmpDirPath, "src", outBuf, TarOptions{Overrides: overrides}); err != nil {
+			t.Fatalf("CreateTarballBytesWithOptions() error = %v", err)
+		}
+		zr, err := gzip.NewReader(outBuf)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		tr := tar.NewReader(zr)
+		n := 0
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			n++
+			if mode := h.FileInfo().Mode(); mode != want[h.Name] {
+				t.Errorf("CreateTarballBytesWithOptions() %s mode = %v, want %v", h.Name, mode, want[h.Name])
+			}
+			if !h.ModTime.Equal(epoch) {
+				t.Errorf("CreateTarballBytesWithOptions() %s mtime = %v, want %v", h.Name, h.ModTime, epoch)
+			}
+			secret := h.Name == "src/secrets" || h.Name == "src/secrets/key"
+			if (h.Uname == "daemon" && h.Uid == 1) != secret {
+				t.Errorf("CreateTarballBytesWithOptions() %s owner = %d %s", h.Name, h.Uid, h.Uname)
+			}
+		}
+		if n != len(want) {
+			t.Errorf("CreateTarballBytesWithOptions() entries = %d, want %d", n, len(want))
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		outBuf := &bytes.Buffer{}
+		if err := CreateZipballBytesWithOptions(tmpDirPath, "src", outBuf, ZipOptions{Overrides: overrides}); err != nil {
+			t.Fatalf("CreateZipballBytesWithOptions() error = %v", err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(outBuf.Bytes()), int64(outBuf.Len()))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(zr.File) != len(want) {
+			t.Errorf("CreateZipballBytesWithOptions() entries = %d, want %d", len(zr.File), len(want))
+		}
+		for _, f := range zr.File {
+			name := filepath.ToSlash(filepath.Clean(f.Name))
+			if f.Mode() != want[name] {
+				t.Errorf("CreateZipballBytesWithOptions() %s mode = %v, want %v", f.Name, f.Mode(), want[name])
+			}
+			if !f.Modified.Equal(epoch) {
+				t.Errorf("CreateZipballBytesWithOptions() %s mtime = %v, want %v", f.Name, f.Modified, epoch)
+			}
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		bad := TarOptions{Overrides: Overrides{{Pattern: "[", Mode: 0644}}}
+		if err := CreateTarballBytesWithOptions(tmpDirPath, "src", ioutil.Discard, bad); err == nil {
+			t.Errorf("CreateTarballBytesWithOptions() error = %v, want invalid pattern error", err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+)
+
+// Owner represents the ownership of an archive entry.
+type Owner struct {
+	UID   int
+	GID   int
+	Uname string
+	Gname string
+}
+
+// IDRange maps the Size ids starting at From to the ids starting at To (like user namespace mappings).
+type IDRange struct {
+	From int
+	To   int
+	Size int
+}
+
+// OwnerOptions controls the ownership written to Tar entry headers (or Zip Unix extra fields) instead of the build machine one.
+// Id ranges are mapped first, names are then looked up by the mapped ids and a forced owner overrides everything.
+// Names of remapped ids are cleared unless looked up, since extracting tools prefer names over ids.
+type OwnerOptions struct {
+	// Owner forces the ownership of every entry when it's not nil (e.g. `0:0 root:root`).
+	Owner *Owner
+	// UIDMap maps ranges of user ids. User ids not covered by any range are kept.
+	UIDMap []IDRange
+	// GIDMap maps ranges of group ids. Group ids not covered by any range are kept.
+	GIDMap []IDRange
+	// Unames maps user ids to user names. Names of user ids not found are kept unless the id was remapped.
+	Unames map[int]string
+	// Gnames maps group ids to group names. Names of group ids not found are kept unless the id was remapped.
+	Gnames map[int]string
+}
+
+// validate checks that id ranges are valid and don't overlap.
+func (o *OwnerOptions) validate() error {
+	for _, m := range [][]IDRange{o.UIDMap, o.GIDMap} {
+		for i, r := range m {
+			if r.From < 0 || r.To < 0 || r.Size <= 0 {
+				return fmt.Errorf("archive: invalid id range %d:%d:%d", r.From, r.To, r.Size)
+			}
+			for _, prev := range m[:i] {
+				if r.From < prev.From+prev.Size && prev.From < r.From+r.Size {
+					return fmt.Errorf("archive: id range %d:%d:%d overlaps %d:%d:%d", r.From, r.To, r.Size, prev.From, prev.To, prev.Size)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the ownership of a Tar header.
+func (o *OwnerOptions) apply(h *tar.Header) {
+	if o.Owner != nil {
+		h.Uid, h.Gid = o.Owner.UID, o.Owner.GID
+		h.Uname, h.Gname = o.Owner.Uname, o.Owner.Gname
+		return
+	}
+	uid, gid := o.ids(h.Uid, h.Gid)
+	// The build machine names don't belong to other ids
+	if uid != h.Uid {
+		h.Uname = ""
+	}
+	if gid != h.Gid {
+		h.Gname = ""
+	}
+	h.Uid, h.Gid = uid, gid
+	if name, ok := o.Unames[h.Uid]; ok {
+		h.Uname = name
+	}
+	if name, ok := o.Gnames[h.Gid]; ok {
+		h.Gname = name
+	}
+}
+
+// ids returns the forced or mapped uid and gid.
+func (o *OwnerOptions) ids(uid int, gid int) (int, int) {
+	if o.Owner != nil {
+		return o.Owner.UID, o.Owner.GID
+	}
+	return mapID(o.UIDMap, uid), mapID(o.GIDMap, gid)
+}
+
+func mapID(ranges []IDRange, id int) int {
+	for _, r := range ranges {
+		if id >= r.From && id < r.From+r.Size {
+			return r.To + id - r.From
+		}
+	}
+	return id
+}
@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestCreateTarballBytesWithOptionsOwnership(t *testing.T) {
+	h := &tar.Header{Uid: 1000, Gid: 100, Uname: "builder", Gname: "users"}
+	tests := []struct {
+		name    string
+		opts    OwnerOptions
+		want    Owner
+		wantErr bool
+	}{
+		{
+			name: "keep build machine ownership",
+			want: Owner{UID: 1000, GID: 100, Uname: "builder", Gname: "users"},
+		},
+		{
+			name: "force root ownership",
+			opts: OwnerOptions{
+				Owner:  &Owner{UID: 0, GID: 0, Uname: "root", Gname: "root"},
+				UIDMap: []IDRange{{From: 1000, To: 2000, Size: 1}},
+			},
+			want: Owner{UID: 0, GID: 0, Uname: "root", Gname: "root"},
+		},
+		{
+			name: "map id ranges",
+			opts: OwnerOptions{
+				UIDMap: []IDRange{{From: 0, To: 100000, Size: 1000}, {From: 1000, To: 0, Size: 1}},
+				GIDMap: []IDRange{{From: 50, To: 500, Size: 100}},
+			},
+			want: Owner{UID: 0, GID: 550},
+		},
+		{
+			name: "ids mapped to themselves keep names",
+			opts: OwnerOptions{
+				UIDMap: []IDRange{{From: 0, To: 0, Size: 65536}},
+				GIDMap: []IDRange{{From: 0, To: 0, Size: 65536}},
+			},
+			want: Owner{UID: 1000, GID: 100, Uname: "builder", Gname: "users"},
+		},
+		{
+			name: "look names up by mapped ids",
+			opts: OwnerOptions{
+				UIDMap: []IDRange{{From: 1000, To: 0, Size: 1}},
+				Unames: map[int]string{0: "root"},
+				Gnames: map[int]string{100: "staff"},
+			},
+			want: Owner{UID: 0, GID: 100, Uname: "root", Gname: "staff"},
+		},
+		{
+			name:    "invalid id range",
+			opts:    OwnerOptions{GIDMap: []IDRange{{From: 0, To: 0, Size: 0}}},
+			wantErr: true,
+		},
+		{
+			name:    "overlapping id ranges",
+			opts:    OwnerOptions{UIDMap: []IDRange{{From: 0, To: 10, Size: 10}, {From: 5, To: 100, Size: 10}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				outBuf := &bytes.Buffer{}
+				if err := CreateTarballBytesWithOptions("", "./fixtures", outBuf, TarOptions{Ownership: tt.opts}); err == nil {
+					t.Errorf("CreateTarballBytesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			got := *h
+			tt.opts.apply(&got)
+			if o := (Owner{got.Uid, got.Gid, got.Uname, got.Gname}); o != tt.want {
+				t.Errorf("apply() = %+v, want %+v", o, tt.want)
+			}
+		})
+	}
+
+	// Every header written is normalized
+	outBuf := &bytes.Buffer{}
+	opts := TarOptions{Ownership: OwnerOptions{Owner: &Owner{Uname: "root", Gname: "root"}}}
+	if err := CreateTarballBytesWithOptions("", "./fixtures", outBuf, opts); err != nil {
+		t.Fatalf("CreateTarballBytesWithOptions() error = %v", err)
+	}
+	zr, err := gzip.NewReader(outBuf)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if h.Uid != 0 || h.Gid != 0 || h.Uname != "root" || h.Gname != "root" {
+			t.Errorf("CreateTarballBytesWithOptions() %s owner = %d:%d %s:%s", h.Name, h.Uid, h.Gid, h.Uname, h.Gname)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limit identifies a reading limit.
+type Limit uint8
+
+const (
+	// LimitTotalSize is the maximum total uncompressed size limit.
+	LimitTotalSize Limit = iota + 1
+	// LimitEntries is the maximum entry count limit.
+	LimitEntries
+	// LimitEntrySize is the maximum per-entry uncompressed size limit.
+	LimitEntrySize
+	// LimitCompressionRatio is the maximum compression ratio limit.
+	LimitCompressionRatio
+	// LimitPathDepth is the maximum entry path depth limit.
+	LimitPathDepth
+	// LimitPathLength is the maximum entry path length limit.
+	LimitPathLength
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitTotalSize:
+		return "total size"
+	case LimitEntries:
+		return "entry count"
+	case LimitEntrySize:
+		return "entry size"
+	case LimitCompressionRatio:
+		return "compression ratio"
+	case LimitPathDepth:
+		return "path depth"
+	case LimitPathLength:
+		return "path length"
+	default:
+		return "unknown"
+	}
+}
+
+// Limits represents the limits enforced when reading untrusted archives.
+// A zero value field means no limit.
+type Limits struct {
+	// MaxTotalSize is the maximum total uncompressed size of all entries in bytes.
+	MaxTotalSize int64
+	// MaxEntries is the maximum amount of entries.
+	MaxEntries int
+	// MaxEntrySize is the maximum uncompressed size of a single entry in bytes.
+	MaxEntrySize int64
+	// MaxCompressionRatio is the maximum ratio between uncompressed and compressed sizes (e.g. 100 for 100:1).
+	// Zip entries are checked one by one while Tar/Gzip archives are checked as a whole stream.
+	MaxCompressionRatio int64
+	// MaxPathDepth is the maximum amount of path components of an entry name.
+	MaxPathDepth int
+	// MaxPathLength is the maximum length of an entry name in bytes.
+	MaxPathLength int
+}
+
+// DefaultLimits returns conservative limits suitable for reading untrusted uploads.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxTotalSize:        1 << 30,
+		MaxEntries:          10000,
+		MaxEntrySize:        512 << 20,
+		MaxCompressionRatio: 100,
+		MaxPathDepth:        32,
+		MaxPathLength:       1024,
+	}
+}
+
+// LimitError is returned as soon as a reading limit is crossed.
+type LimitError struct {
+	// Limit is the limit crossed.
+	Limit Limit
+	// Entry is the entry name which crossed the limit.
+	Entry string
+	// Max is the limit value.
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("archive: entry %q exceeds the %s limit of %d", e.Entry, e.Limit, e.Max)
+}
+
+// maxSymlinkSize is the maximum size of a Zip symbolic link entry target.
+const maxSymlinkSize = 4096
+
+// Entry represents an archive entry header.
+type Entry struct {
+	// Name is the entry path name using forward slashes. Legacy encoded Zip names are transcoded to UTF-8.
+	Name string
+	// Size is the entry uncompressed size in bytes.
+	Size int64
+	// Mode is the entry file mode and permission bits.
+	Mode os.FileMode
+	// ModTime is the entry modification time.
+	ModTime time.Time
+	// Linkname is the target of a symbolic link or hard link entry.
+	Linkname string
+	// Tar is the original Tar header or nil for Zip entries.
+	Tar *tar.Header
+	// Zip is the original Zip header or nil for Tar entries.
+	Zip *zip.FileHeader
+}
+
+// Reader reads Tar/Gzip or Zip archive entries sequentially enforcing reading limits.
+// Limits are checked against entry headers before reading their data and against the actual data while it's read.
+type Reader struct {
+	limits Limits
+	entry  *Entry
+	cur    io.Reader
+
+	// read bytes of the current entry, declared size of all entries so far and entry count
+	entryRead int64
+	total     int64
+	entries   int
+
+	// Tar/Gzip state
+	tr           *tar.Reader
+	gzip         *GzipHeader
+	compressed   *countingReader
+	uncompressed *countingReader
+
+	// Zip state
+	zr           *zip.Reader
+	zfile        int
+	zrc          io.ReadCloser
+	nameDecoders []NameDecoder
+}
+
+// ZipReaderOptions represents the Zip archive reading options.
+type ZipReaderOptions struct {
+	// NameDecoders are tried in order to decode entry names without the UTF-8 flag which aren't valid UTF-8
+	// (e.g. `DecodeShiftJIS` or `DecodeGBK`). Names no decoder accepts are decoded as IBM Code Page 437.
+	// When nil, Shift-JIS and GBK names are detected from the characters they decode to, which may guess wrong
+	// on short names. An empty slice always decodes them as IBM Code Page 437.
+	NameDecoders []NameDecoder
+}
+
+// NewTarballReader creates a Reader reading a Tar/Gzip archive from r.
+func NewTarballReader(r io.Reader, limits Limits) (*Reader, error) {
+	compressed := &countingReader{r: r}
+	zr, err := gzip.NewReader(bufio.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	uncompressed := &countingReader{r: zr}
+	return &Reader{
+		limits:       limits,
+		tr:           tar.NewReader(uncompressed),
+		gzip:         newGzipHeader(zr),
+		compressed:   compressed,
+		uncompressed: uncompressed,
+	}, nil
+}
+
+// NewZipballReader creates a Reader reading a Zip archive of the given size from r.
+// Legacy encoded entry names are transcoded to UTF-8 (see `NewZipballReaderWithOptions`).
+func NewZipballReader(r io.ReaderAt, size int64, limits Limits) (*Reader, error) {
+	return NewZipballReaderWithOptions(r, size, limits, ZipReaderOptions{})
+}
+
+// NewZipballReaderWithOptions creates a Reader reading a Zip archive of the given size from r with the given options.
+// Entry names without the UTF-8 flag are taken from Info-ZIP Unicode Path extra fields, kept when they are valid UTF-8
+// or decoded by the name decoders and finally as IBM Code Page 437.
+func NewZipballReaderWithOptions(r io.ReaderAt, size int64, limits Limits, opts ZipReaderOptions) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	// The central directory tells the entry count upfront
+	if limits.MaxEntries > 0 && len(zr.File) > limits.MaxEntries {
+		name := decodeZipName(&zr.File[limits.MaxEntries].FileHeader, opts.NameDecoders)
+		return nil, &LimitError{Limit: LimitEntries, Entry: name, Max: int64(limits.MaxEntries)}
+	}
+	return &Reader{limits: limits, zr: zr, nameDecoders: opts.NameDecoders}, nil
+}
+
+// GzipHeader returns the Gzip header metadata of a Tar/Gzip archive or nil for Zip archives.
+func (r *Reader) GzipHeader() *GzipHeader {
+	return r.gzip
+}
+
+// Comment returns the archive comment of a Zip archive or an empty string for Tar/Gzip archives.
+func (r *Reader) Comment() string {
+	if r.zr == nil {
+		return ""
+	}
+	return r.zr.Comment
+}
+
+// Next advances to the next entry skipping the remaining data of the current one.
+// It returns io.EOF at the end of the archive or a `*LimitError` if the entry header crosses a limit.
+func (r *Reader) Next() (*Entry, error) {
+	if r.zrc != nil {
+		r.zrc.Close()
+		r.zrc = nil
+	}
+	r.cur = nil
+	r.entryRead = 0
+
+	var e *Entry
+	var err error
+	if r.tr != nil {
+		e, err = r.nextTar()
+	} else {
+		e, err = r.nextZip()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.entry = e
+	r.entries++
+	// Declared sizes are checked before reading any entry data
+	if err := r.checkHeader(e); err != nil {
+		return nil, err
+	}
+	r.total += e.Size
+	if r.tr != nil {
+		r.cur = r.tr
+		return e, nil
+	}
+	if err := r.openZip(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *Reader) nextTar() (*Entry, error) {
+	h, err := r.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkRatio(h.Name); err != nil {
+		return nil, err
+	}
+	fi := h.FileInfo()
+	return &Entry{
+		Name:     h.Name,
+		Size:     h.Size,
+		Mode:     fi.Mode(),
+		ModTime:  h.ModTime,
+		Linkname: h.Linkname,
+		Tar:      h,
+	}, nil
+}
+
+func (r *Reader) nextZip() (*Entry, error) {
+	if r.zfile >= len(r.zr.File) {
+		return nil, io.EOF
+	}
+	f := r.zr.File[r.zfile]
+	r.zfile++
+	e := &Entry{
+		Name:    decodeZipName(&f.FileHeader, r.nameDecoders),
+		Size:    int64(f.UncompressedSize64),
+		Mode:    f.Mode(),
+		ModTime: f.Modified,
+		Zip:     &f.FileHeader,
+	}
+	if e.ModTime.IsZero() {
+		e.ModTime = f.ModTime()
+	}
+	return e, nil
+}
+
+// openZip opens the current Zip entry data once its declared compression ratio is checked.
+func (r *Reader) openZip(e *Entry) error {
+	if err := r.checkZipRatio(e.Name, e.Zip.UncompressedSize64, e.Zip.CompressedSize64); err != nil {
+		return err
+	}
+	rc, err := r.zr.File[r.zfile-1].Open()
+	if err != nil {
+		return err
+	}
+	r.zrc = rc
+	r.cur = rc
+	// Zip symbolic links store their target as the entry content
+	if e.Mode&os.ModeSymlink != 0 {
+		if e.Size > maxSymlinkSize {
+			return fmt.Errorf("archive/zip: symbolic link %q target too long", e.Name)
+		}
+		target, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		e.Linkname = string(target)
+	}
+	return nil
+}
+
+// Read reads the current entry data enforcing the entry size and compression ratio limits.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.cur == nil {
+		return 0, io.EOF
+	}
+	n, err := r.cur.Read(p)
+	r.entryRead += int64(n)
+	name := r.entry.Name
+	// Underlying readers never return more data than declared, this only guards against mismatching headers
+	if r.limits.MaxEntrySize > 0 && r.entryRead > r.limits.MaxEntrySize {
+		return n, &LimitError{Limit: LimitEntrySize, Entry: name, Max: r.limits.MaxEntrySize}
+	}
+	if r.tr != nil {
+		if errr := r.checkRatio(name); errr != nil {
+			return n, errr
+		}
+	} else if errr := r.checkZipRatio(name, uint64(r.entryRead), r.entry.Zip.CompressedSize64); errr != nil {
+		return n, errr
+	}
+	return n, err
+}
+
+// checkHeader checks an entry header against the entry count, declared size and path limits.
+// Tar/Gzip entries are counted once their header is read while Zip entries are counted upfront.
+func (r *Reader) checkHeader(e *Entry) error {
+	l := r.limits
+	if l.MaxEntries > 0 && r.entries > l.MaxEntries {
+		return &LimitError{Limit: LimitEntries, Entry: e.Name, Max: int64(l.MaxEntries)}
+	}
+	if l.MaxPathLength > 0 && len(e.Name) > l.MaxPathLength {
+		return &LimitError{Limit: LimitPathLength, Entry: e.Name, Max: int64(l.MaxPathLength)}
+	}
+	if l.MaxPathDepth > 0 && pathDepth(e.Name) > l.MaxPathDepth {
+		return &LimitError{Limit: LimitPathDepth, Entry: e.Name, Max: int64(l.MaxPathDepth)}
+	}
+	if l.MaxEntrySize > 0 && e.Size > l.MaxEntrySize {
+		return &LimitError{Limit: LimitEntrySize, Entry: e.Name, Max: l.MaxEntrySize}
+	}
+	if l.MaxTotalSize > 0 && r.total+e.Size > l.MaxTotalSize {
+		return &LimitError{Limit: LimitTotalSize, Entry: e.Name, Max: l.MaxTotalSize}
+	}
+	return nil
+}
+
+// checkRatio checks the whole Tar/Gzip stream compression ratio read so far.
+func (r *Reader) checkRatio(name string) error {
+	max := r.limits.MaxCompressionRatio
+	if max > 0 && r.uncompressed.n > max*r.compressed.n {
+		return &LimitError{Limit: LimitCompressionRatio, Entry: name, Max: max}
+	}
+	return nil
+}
+
+// checkZipRatio checks a Zip entry compression ratio.
+func (r *Reader) checkZipRatio(name string, usize uint64, csize uint64) error {
+	max := r.limits.MaxCompressionRatio
+	if max > 0 && usize > uint64(max)*csize {
+		return &LimitError{Limit: LimitCompressionRatio, Entry: name, Max: max}
+	}
+	return nil
+}
+
+// pathDepth returns the amount of path components of a slash-separated entry name.
+func pathDepth(name string) int {
+	depth := 0
+	for _, p := range strings.Split(path.Clean("/"+name), "/") {
+		if p != "" {
+			depth++
+		}
+	}
+	return depth
+}
@@ -0,0 +1,218 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name string
+	body string
+	mode int64
+	typ  byte
+	link string
+}
+
+func testTarball(t *testing.T, entries []testEntry) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Typeflag: e.typ, Linkname: e.link, Size: int64(len(e.body))}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		if h.Typeflag != tar.TypeReg {
+			h.Size = 0
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := io.WriteString(tw, e.body); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func testZipball(t *testing.T, entries []testEntry) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := os.FileMode(0644)
+		if e.mode != 0 {
+			mode = os.FileMode(e.mode)
+		}
+		body := e.body
+		switch e.typ {
+		case tar.TypeDir:
+			mode |= os.ModeDir
+		case tar.TypeSymlink:
+			mode |= os.ModeSymlink
+			body = e.link
+		}
+		h.SetMode(mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := io.WriteString(w, body); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestReader(t *testing.T, format string, entries []testEntry, limits Limits) (*Reader, error) {
+	if format == "zip" {
+		data := testZipball(t, entries)
+		return NewZipballReader(bytes.NewReader(data), int64(len(data)), limits)
+	}
+	return NewTarballReader(bytes.NewReader(testTarball(t, entries)), limits)
+}
+
+// readAll reads all the entries data returning the names read.
+func readAll(r *Reader) ([]string, error) {
+	var names []string
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		names = append(names, e.Name)
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return names, err
+		}
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	zeros := strings.Repeat("\x00", 1<<20)
+	small := []testEntry{{name: "a.txt", body: "a"}, {name: "b.txt", body: "b"}, {name: "c.txt", body: "c"}}
+	tests := []struct {
+		name      string
+		entries   []testEntry
+		limits    Limits
+		wantLimit Limit
+		wantEntry string
+	}{
+		{
+			name:    "no limits",
+			entries: append(small, testEntry{name: "zeros", body: zeros}),
+		},
+		{
+			name:    "default limits",
+			entries: append(small, testEntry{name: "dir/", typ: tar.TypeDir}),
+			limits:  DefaultLimits(),
+		},
+		{
+			name:      "entry count",
+			entries:   small,
+			limits:    Limits{MaxEntries: 2},
+			wantLimit: LimitEntries,
+			wantEntry: "c.txt",
+		},
+		{
+			name:      "entry size",
+			entries:   append(small, testEntry{name: "big.txt", body: "0123456789"}),
+			limits:    Limits{MaxEntrySize: 9},
+			wantLimit: LimitEntrySize,
+			wantEntry: "big.txt",
+		},
+		{
+			name:      "total size",
+			entries:   small,
+			limits:    Limits{MaxTotalSize: 2},
+			wantLimit: LimitTotalSize,
+			wantEntry: "c.txt",
+		},
+		{
+			name:      "compression ratio",
+			entries:   append(small, testEntry{name: "zeros", body: zeros}),
+			limits:    Limits{MaxCompressionRatio: 100},
+			wantLimit: LimitCompressionRatio,
+			wantEntry: "zeros",
+		},
+		{
+			name:      "path depth",
+			entries:   append(small, testEntry{name: "a/b/c/d.txt", body: "d"}),
+			limits:    Limits{MaxPathDepth: 3},
+			wantLimit: LimitPathDepth,
+			wantEntry: "a/b/c/d.txt",
+		},
+		{
+			name:      "path length",
+			entries:   append(small, testEntry{name: strings.Repeat("x", 101), body: "x"}),
+			limits:    Limits{MaxPathLength: 100},
+			wantLimit: LimitPathLength,
+			wantEntry: strings.Repeat("x", 101),
+		},
+	}
+	for _, format := range []string{"tar", "zip"} {
+		for _, tt := range tests {
+			t.Run(format+" "+tt.name, func(t *testing.T) {
+				r, err := newTestReader(t, format, tt.entries, tt.limits)
+				if err == nil {
+					_, err = readAll(r)
+				}
+				if tt.wantLimit == 0 {
+					if err != nil {
+						t.Errorf("readAll() error = %v", err)
+					}
+					return
+				}
+				var lerr *LimitError
+				if !errors.As(err, &lerr) {
+					t.Fatalf("readAll() error = %v, want *LimitError", err)
+				}
+				if lerr.Limit != tt.wantLimit || lerr.Entry != tt.wantEntry {
+					t.Errorf("readAll() error = %v, want %v limit for %q", err, tt.wantLimit, tt.wantEntry)
+				}
+			})
+		}
+	}
+}
+
+func TestReaderRatioWhileStreaming(t *testing.T) {
+	// A Tar/Gzip bomb is only detected while it's decompressed so no more than a few reads happen
+	data := testTarball(t, []testEntry{{name: "zeros", body: strings.Repeat("\x00", 16<<20)}})
+	r, err := NewTarballReader(bytes.NewReader(data), Limits{MaxCompressionRatio: 100})
+	if err != nil {
+		t.Fatalf("NewTarballReader() error = %v", err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitCompressionRatio {
+		t.Fatalf("Read() error = %v, want compression ratio limit error", err)
+	}
+	if n >= 16<<20 {
+		t.Errorf("Read() read %d bytes before failing", n)
+	}
+}
@@ -0,0 +1,294 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sparseFragment represents a data region of a sparse file.
+type sparseFragment struct {
+	offset int64
+	length int64
+}
+
+// PAX sparse format 1.0 records (https://www.gnu.org/software/tar/manual/html_node/Sparse-Formats.html)
+const (
+	paxGNUSparsePrefix   = "GNU.sparse."
+	paxGNUSparseMajor    = "GNU.sparse.major"
+	paxGNUSparseMinor    = "GNU.sparse.minor"
+	paxGNUSparseName     = "GNU.sparse.name"
+	paxGNUSparseRealSize = "GNU.sparse.realsize"
+)
+
+// isSparseTar reports whether a Tar header describes a sparse file in any GNU sparse format.
+func isSparseTar(h *tar.Header) bool {
+	if h.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, paxGNUSparsePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTarFile writes the header and content of a regular file.
+// With the Sparse option files having holes are written as PAX sparse format 1.0 entries.
+func writeTarFile(tw *tar.Writer, w io.Writer, h *tar.Header, file string, opts *TarOptions) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.Sparse {
+		frags, err := sparseFragments(f, h.Size)
+		if err != nil {
+			return fmt.Errorf("archive/tar: can't detect holes of %s: %w", file, err)
+		}
+		var n int64
+		for _, frag := range frags {
+			n += frag.length
+		}
+		if n < h.Size {
+			if err := prepareTarHeader(h, file, opts); err != nil {
+				return err
+			}
+			return writeSparseTar(tw, w, h, f, frags)
+		}
+	}
+	if err := writeTarHeader(tw, h, file, opts); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writeSparseTar writes a sparse file header and its data regions to w, the underlying writer of tw.
+// The standard library can't write sparse files so the entry is encoded here in between two tw entries.
+func writeSparseTar(tw *tar.Writer, w io.Writer, h *tar.Header, f io.ReaderAt, frags []sparseFragment) error {
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// A file ending with a hole carries a last empty region to keep its size
+	if n := len(frags); n == 0 || frags[n-1].offset+frags[n-1].length < h.Size {
+		frags = append(frags, sparseFragment{h.Size, 0})
+	}
+	// The sparse map precedes the data regions
+	var smap strings.Builder
+	smap.WriteString(strconv.Itoa(len(frags)) + "\n")
+	var size int64
+	for _, frag := range frags {
+		smap.WriteString(strconv.FormatInt(frag.offset, 10) + "\n" + strconv.FormatInt(frag.length, 10) + "\n")
+		size += frag.length
+	}
+	smap.WriteString(strings.Repeat("\x00", tarPadding(int64(smap.Len()))))
+	size += int64(smap.Len())
+
+	records := map[string]string{
+		paxGNUSparseMajor:    "1",
+		paxGNUSparseMinor:    "0",
+		paxGNUSparseName:     h.Name,
+		paxGNUSparseRealSize: strconv.FormatInt(h.Size, 10),
+	}
+	for k, v := range h.PAXRecords {
+		if strings.HasPrefix(k, xattrPAXPrefix) {
+			records[k] = v
+		}
+	}
+	if h.ModTime.Nanosecond() != 0 || !fitsOctal(h.ModTime.Unix(), 12) {
+		records["mtime"] = formatPAXTime(h.ModTime)
+	}
+	if !fitsOctal(int64(h.Uid), 8) {
+		records["uid"] = strconv.Itoa(h.Uid)
+	}
+	if !fitsOctal(int64(h.Gid), 8) {
+		records["gid"] = strconv.Itoa(h.Gid)
+	}
+	if !fitsString(h.Uname, 32) {
+		records["uname"] = h.Uname
+	}
+	if !fitsString(h.Gname, 32) {
+		records["gname"] = h.Gname
+	}
+	if !fitsOctal(size, 12) {
+		records["size"] = strconv.FormatInt(size, 10)
+	}
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pax strings.Builder
+	for _, k := range keys {
+		pax.WriteString(paxRecord(k, records[k]))
+	}
+
+	// Readers without sparse support extract the raw entry under a different name
+	dir, file := path.Split(h.Name)
+	xh := *h
+	xh.Name = path.Join(dir, "PaxHeaders.0", file)
+	if _, err := w.Write(tarHeaderBlock(&xh, tar.TypeXHeader, int64(pax.Len()))); err != nil {
+		return err
+	}
+	if err := writePadded(w, strings.NewReader(pax.String()), int64(pax.Len())); err != nil {
+		return err
+	}
+	sh := *h
+	sh.Name = path.Join(dir, "GNUSparseFile.0", file)
+	if _, err := w.Write(tarHeaderBlock(&sh, tar.TypeReg, size)); err != nil {
+		return err
+	}
+	readers := []io.Reader{strings.NewReader(smap.String())}
+	for _, frag := range frags {
+		readers = append(readers, io.NewSectionReader(f, frag.offset, frag.length))
+	}
+	return writePadded(w, io.MultiReader(readers...), size)
+}
+
+// sparseBlockSize is the size of the zero blocks turned into holes on extraction.
+const sparseBlockSize = 4096
+
+// copySparse copies the data of a sparse file from r to f seeking over zero blocks instead of writing them
+// so the file system recreates the holes.
+func copySparse(f *os.File, r io.Reader, size int64) error {
+	buf := make([]byte, sparseBlockSize)
+	for remaining := size; remaining > 0; {
+		b := buf
+		if remaining < int64(len(b)) {
+			b = b[:remaining]
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		remaining -= int64(len(b))
+		if isZero(b) {
+			if _, err := f.Seek(int64(len(b)), io.SeekCurrent); err != nil {
+				return err
+			}
+		} else if _, err := f.Write(b); err != nil {
+			return err
+		}
+	}
+	// A trailing hole is only allocated by setting the file size
+	return f.Truncate(size)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writePadded copies exactly size bytes from r to w followed by the block padding.
+func writePadded(w io.Writer, r io.Reader, size int64) error {
+	n, err := io.CopyN(w, r, size)
+	if err == io.EOF {
+		return fmt.Errorf("archive/tar: missed writing %d bytes", size-n)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(make([]byte, tarPadding(size)))
+	return err
+}
+
+// tarHeaderBlock encodes a USTAR header block. Values which don't fit are expected to be stored as PAX records.
+func tarHeaderBlock(h *tar.Header, typeflag byte, size int64) []byte {
+	b := make([]byte, tarBlockSize)
+	putString(b[0:100], h.Name)
+	putOctal(b[100:108], h.Mode&07777)
+	putOctal(b[108:116], int64(h.Uid))
+	putOctal(b[116:124], int64(h.Gid))
+	putOctal(b[124:136], size)
+	putOctal(b[136:148], h.ModTime.Unix())
+	b[156] = typeflag
+	copy(b[257:265], "ustar\x0000")
+	putString(b[265:297], h.Uname)
+	putString(b[297:329], h.Gname)
+	// The checksum is computed with its own field filled with spaces
+	copy(b[148:156], "        ")
+	var sum int64
+	for _, c := range b {
+		sum += int64(c)
+	}
+	copy(b[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return b
+}
+
+// putString writes a NUL padded string field truncated to its size.
+func putString(b []byte, s string) {
+	if len(s) > len(b) {
+		s = s[:len(b)]
+	}
+	copy(b, s)
+}
+
+// putOctal writes a NUL terminated octal number field or zero if it doesn't fit.
+func putOctal(b []byte, n int64) {
+	if !fitsOctal(n, len(b)) {
+		n = 0
+	}
+	copy(b, fmt.Sprintf("%0*o\x00", len(b)-1, n))
+}
+
+// fitsOctal reports whether n fits a NUL terminated octal number field of the given size.
+func fitsOctal(n int64, size int) bool {
+	return n >= 0 && n < 1<<(3*uint(size-1))
+}
+
+// fitsString reports whether s fits a USTAR string field of the given size.
+func fitsString(s string, size int) bool {
+	if len(s) > size {
+		return false
+	}
+	for _, c := range s {
+		if c == 0 || c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// paxRecord formats a PAX record whose length prefix counts itself.
+func paxRecord(k string, v string) string {
+	size := len(k) + len(v) + 3
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + k + "=" + v + "\n"
+	// The length prefix digits may grow once counted
+	if len(record) != size {
+		size = len(record)
+		record = strconv.Itoa(size) + " " + k + "=" + v + "\n"
+	}
+	return record
+}
+
+// formatPAXTime formats a time as PAX decimal seconds. Sub-second precision of times before 1970 is dropped.
+func formatPAXTime(t time.Time) string {
+	if t.Unix() < 0 {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%09d", t.Nanosecond()), "0")
+	if frac == "" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return strconv.FormatInt(t.Unix(), 10) + "." + frac
+}
+
+// tarPadding returns the number of bytes padding size to a whole block.
+func tarPadding(size int64) int {
+	return int(-size & (tarBlockSize - 1))
+}
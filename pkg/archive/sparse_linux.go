@@ -0,0 +1,50 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lseek whence values of Linux 3.1+
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// sparseFragments lists the data regions of the first size bytes of a file using SEEK_DATA and SEEK_HOLE.
+// File systems not supporting them report a single data region.
+func sparseFragments(f *os.File, size int64) ([]sparseFragment, error) {
+	fd := int(f.Fd())
+	var frags []sparseFragment
+	for off := int64(0); off < size; {
+		data, err := unix.Seek(fd, off, seekData)
+		if errors.Is(err, unix.ENXIO) {
+			break
+		}
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+			return []sparseFragment{{0, size}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data >= size {
+			break
+		}
+		hole, err := unix.Seek(fd, data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		frags = append(frags, sparseFragment{data, hole - data})
+		off = hole
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return frags, nil
+}
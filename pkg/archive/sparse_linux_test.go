@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTarballSparse(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// A disk image having two data regions and ending with a hole under a path too long for USTAR
+	dir := filepath.Join(tmpDirPath, "src", strings.Repeat("d", 80), strings.Repeat("e", 80))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	const size = 8 << 20
+	want := make([]byte, size)
+	copy(want, "boot sector")
+	copy(want[4<<20:], bytes.Repeat([]byte("data"), 2048))
+	file := filepath.Join(dir, "disk.img")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := f.WriteAt(want[:11], 0); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := f.WriteAt(want[4<<20:4<<20+8192], 4<<20); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("%v", err)
+	}
+	f.Close()
+	mtime := time.Unix(1600000000, 123456789)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if allocated(t, file) >= size {
+		t.Skip("file system doesn't support sparse files")
+	}
+	name := filepath.ToSlash(filepath.Join("src", strings.Repeat("d", 80), strings.Repeat("e", 80), "disk.img"))
+
+	outBuf := &bytes.Buffer{}
+	if err := CreateTarballBytesWithOptions(tmpDirPath, "src", outBuf, TarOptions{Sparse: true}); err != nil {
+		t.Fatalf("CreateTarballBytesWithOptions() error = %v", err)
+	}
+	data := outBuf.Bytes()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(raw) > 64<<10 {
+		t.Errorf("CreateTarballBytesWithOptions() tar size = %d, want holes to be skipped", len(raw))
+	}
+	tr := tar.NewReader(bytes.NewReader(raw))
+	found := false
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if h.Name != name {
+			continue
+		}
+		found = true
+		if h.Size != size || !h.ModTime.Equal(mtime) {
+			t.Errorf("CreateTarballBytesWithOptions() header size = %d, mtime = %v, want %d, %v", h.Size, h.ModTime, size, mtime)
+		}
+		got, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("CreateTarballBytesWithOptions() sparse content mismatch")
+		}
+	}
+	if !found {
+		t.Fatalf("CreateTarballBytesWithOptions() entry %q not found", name)
+	}
+
+	// Extraction recreates the holes
+	r, err := NewTarballReader(bytes.NewReader(data), DefaultLimits())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dst := filepath.Join(tmpDirPath, "dst")
+	if err := r.Extract(dst); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	extracted := filepath.Join(dst, filepath.FromSlash(name))
+	got, err := ioutil.ReadFile(extracted)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Extract() sparse content mismatch")
+	}
+	if n := allocated(t, extracted); n > 1<<20 {
+		t.Errorf("Extract() allocated %d bytes, want holes to be recreated", n)
+	}
+
+	// Sparse entries are understood by GNU tar and bsdtar
+	if _, err := exec.LookPath("tar"); err == nil {
+		archive := filepath.Join(tmpDirPath, "sparse.tar.gz")
+		if err := ioutil.WriteFile(archive, data, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		tarDst := filepath.Join(tmpDirPath, "tar")
+		if err := os.MkdirAll(tarDst, 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if out, err := exec.Command("tar", "-xzf", archive, "-C", tarDst).CombinedOutput(); err != nil {
+			t.Fatalf("tar -xzf error = %v: %s", err, out)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(tarDst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("tar -xzf sparse content mismatch")
+		}
+	}
+
+	if err := CreateTarballBytesWithOptions(tmpDirPath, "src", &bytes.Buffer{}, TarOptions{Sparse: true, Format: tar.FormatUSTAR}); err == nil {
+		t.Errorf("CreateTarballBytesWithOptions() error = nil, want USTAR sparse error")
+	}
+}
+
+// allocated returns the disk space allocated by a file.
+func allocated(t *testing.T, file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512
+}
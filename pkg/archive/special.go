@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+)
+
+// SpecialPolicy represents how a kind of special file is archived.
+type SpecialPolicy int
+
+const (
+	// SpecialDefault archives FIFOs and device nodes and skips sockets.
+	SpecialDefault SpecialPolicy = iota
+	// SpecialArchive records the file header (including device major and minor numbers). Sockets can't be archived.
+	SpecialArchive
+	// SpecialSkip leaves the file out of the archive reporting it.
+	SpecialSkip
+	// SpecialFail makes the archiving fail.
+	SpecialFail
+)
+
+// String returns the policy name.
+func (p SpecialPolicy) String() string {
+	switch p {
+	case SpecialDefault:
+		return "default"
+	case SpecialArchive:
+		return "archive"
+	case SpecialSkip:
+		return "skip"
+	case SpecialFail:
+		return "fail"
+	}
+	return fmt.Sprintf("SpecialPolicy(%d)", int(p))
+}
+
+// SpecialFiles controls how FIFOs, character and block devices and sockets are archived.
+type SpecialFiles struct {
+	// FIFOs is the policy of named pipes.
+	FIFOs SpecialPolicy
+	// Devices is the policy of character and block device nodes.
+	Devices SpecialPolicy
+	// Sockets is the policy of Unix domain sockets.
+	Sockets SpecialPolicy
+	// Skipped is called with every special file left out of the archive when it's not nil.
+	Skipped func(file string, mode os.FileMode)
+}
+
+// validate checks that every policy is known and sockets are never archived.
+func (s *SpecialFiles) validate() error {
+	for _, p := range []SpecialPolicy{s.FIFOs, s.Devices, s.Sockets} {
+		if p < SpecialDefault || p > SpecialFail {
+			return fmt.Errorf("archive/tar: unknown special file policy %v", p)
+		}
+	}
+	if s.Sockets == SpecialArchive {
+		return fmt.Errorf("archive/tar: sockets can't be archived")
+	}
+	return nil
+}
+
+// check reports whether a file must be archived according to the policy of its kind.
+// Files other than special files are always archived.
+func (s *SpecialFiles) check(file string, mode os.FileMode) (bool, error) {
+	var p SpecialPolicy
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		p = s.FIFOs
+	case mode&os.ModeDevice != 0:
+		p = s.Devices
+	case mode&os.ModeSocket != 0:
+		p = s.Sockets
+		if p == SpecialDefault {
+			p = SpecialSkip
+		}
+	default:
+		return true, nil
+	}
+	switch p {
+	case SpecialSkip:
+		if s.Skipped != nil {
+			s.Skipped(file, mode)
+		}
+		return false, nil
+	case SpecialFail:
+		return false, fmt.Errorf("archive/tar: special file %s not allowed (%v)", file, mode)
+	}
+	return true, nil
+}
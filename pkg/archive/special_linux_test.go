@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTarballSpecialFiles(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	dev := filepath.Join(tmpDirPath, "rootfs", "dev")
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := unix.Mkfifo(filepath.Join(dev, "initctl"), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l, err := net.Listen("unix", filepath.Join(dev, "log"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer l.Close()
+	// Device nodes (/dev/null and /dev/loop0) can only be created when privileged
+	devices := true
+	if err := unix.Mknod(filepath.Join(dev, "null"), unix.S_IFCHR|0666, int(unix.Mkdev(1, 3))); err != nil {
+		devices = false
+	} else if err := unix.Mknod(filepath.Join(dev, "loop0"), unix.S_IFBLK|0660, int(unix.Mkdev(7, 0))); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tests := []struct {
+		name        string
+		special     SpecialFiles
+		wantEntries []string
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{
+			name:        "default policy",
+			wantEntries: []string{"rootfs", "rootfs/dev", "rootfs/dev/initctl", "rootfs/dev/loop0", "rootfs/dev/null"},
+			wantSkipped: []string{"log"},
+		},
+		{
+			name:        "skip devices",
+			special:     SpecialFiles{Devices: SpecialSkip},
+			wantEntries: []string{"rootfs", "rootfs/dev", "rootfs/dev/initctl"},
+			wantSkipped: []string{"log", "loop0", "null"},
+		},
+		{
+			name:        "skip everything",
+			special:     SpecialFiles{FIFOs: SpecialSkip, Devices: SpecialSkip, Sockets: SpecialSkip},
+			wantEntries: []string{"rootfs", "rootfs/dev"},
+			wantSkipped: []string{"initctl", "log", "loop0", "null"},
+		},
+		{
+			name:    "fail on sockets",
+			special: SpecialFiles{Sockets: SpecialFail},
+			wantErr: true,
+		},
+		{
+			name:    "archive sockets",
+			special: SpecialFiles{Sockets: SpecialArchive},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var skipped []string
+			opts := TarOptions{Special: tt.special}
+			opts.Special.Skipped = func(file string, mode os.FileMode) {
+				skipped = append(skipped, filepath.Base(file))
+			}
+			outBuf := &bytes.Buffer{}
+			err := CreateTarballBytesWithOptions(tmpDirPath, "rootfs", outBuf, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTarballBytesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			zr, err := gzip.NewReader(outBuf)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			tr := tar.NewReader(zr)
+			var entries []string
+			for {
+				h, err := tr.Next()
+				if err != nil {
+					break
+				}
+				entries = append(entries, h.Name)
+				switch h.Name {
+				case "rootfs/dev/initctl":
+					if h.Typeflag != tar.TypeFifo {
+						t.Errorf("CreateTarballBytesWithOptions() %s type = %c, want FIFO", h.Name, h.Typeflag)
+					}
+				case "rootfs/dev/null":
+					if h.Typeflag != tar.TypeChar || h.Devmajor != 1 || h.Devminor != 3 {
+						t.Errorf("CreateTarballBytesWithOptions() %s type = %c %d:%d, want char device 1:3", h.Name, h.Typeflag, h.Devmajor, h.Devminor)
+					}
+				case "rootfs/dev/loop0":
+					if h.Typeflag != tar.TypeBlock || h.Devmajor != 7 || h.Devminor != 0 {
+						t.Errorf("CreateTarballBytesWithOptions() %s type = %c %d:%d, want block device 7:0", h.Name, h.Typeflag, h.Devmajor, h.Devminor)
+					}
+				}
+			}
+			wantEntries, wantSkipped := tt.wantEntries, tt.wantSkipped
+			if !devices {
+				wantEntries, wantSkipped = withoutDevices(wantEntries), withoutDevices(wantSkipped)
+			}
+			sort.Strings(entries)
+			sort.Strings(skipped)
+			if !reflect.DeepEqual(entries, wantEntries) {
+				t.Errorf("CreateTarballBytesWithOptions() entries = %v, want %v", entries, wantEntries)
+			}
+			if !reflect.DeepEqual(skipped, wantSkipped) {
+				t.Errorf("CreateTarballBytesWithOptions() skipped = %v, want %v", skipped, wantSkipped)
+			}
+		})
+	}
+
+	// A single FIFO source
+	outBuf := &bytes.Buffer{}
+	if err := CreateTarballBytes(filepath.Join(tmpDirPath, "rootfs"), "dev/initctl", outBuf); err != nil {
+		t.Fatalf("CreateTarballBytes() error = %v", err)
+	}
+	zr, err := gzip.NewReader(outBuf)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h, err := tar.NewReader(zr).Next()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if h.Name != "initctl" || h.Typeflag != tar.TypeFifo {
+		t.Errorf("CreateTarballBytes() entry = %s %c, want initctl FIFO", h.Name, h.Typeflag)
+	}
+}
+
+func withoutDevices(names []string) []string {
+	var out []string
+	for _, name := range names {
+		if base := filepath.Base(name); base != "null" && base != "loop0" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -9,13 +9,134 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// TarOptions represents the Tar/Gzip archive creation options.
+type TarOptions struct {
+	// Ownership controls the uid/gid and user/group names written to every header.
+	Ownership OwnerOptions
+	// Overrides are glob rules overriding modes, modification times and owners of matching entries.
+	// They are applied after Ownership.
+	Overrides Overrides
+	// Format forces the Tar header format (`tar.FormatUSTAR`, `tar.FormatPAX` or `tar.FormatGNU`).
+	// Entries which can't be represented in it (e.g. long or non-ASCII names in USTAR) make the archiving fail.
+	// The zero value lets each header use the most compatible format able to represent it.
+	Format tar.Format
+	// Xattrs stores the extended attributes of every entry (including POSIX ACLs, file capabilities and SELinux labels)
+	// as PAX `SCHILY.xattr.*` records. Entries carrying them require the PAX format. Only supported on Linux.
+	Xattrs bool
+	// Sparse stores the holes of sparse files (e.g. VM disk images) using the PAX sparse format 1.0
+	// instead of writing their zeros. It requires the PAX format. Holes are only detected on Linux.
+	Sparse bool
+	// Special controls how FIFOs, device nodes and sockets are archived.
+	// By default FIFOs and devices are recorded with their major and minor numbers and sockets are skipped.
+	Special SpecialFiles
+	// Gzip is the Gzip header metadata (original name, comment, modification time and operating system).
+	Gzip GzipHeader
+	// Exclude are files left out of the archive, compared with `os.SameFile` (e.g. the archive being written inside src).
+	Exclude []os.FileInfo
+}
+
+// fileID identifies a file by device and inode numbers.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// isExcluded reports whether a file is one of the excluded files.
+func isExcluded(fi os.FileInfo, exclude []os.FileInfo) bool {
+	for _, e := range exclude {
+		if os.SameFile(fi, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// xattrPAXPrefix is the PAX record prefix of extended attributes used by GNU tar, bsdtar and star.
+const xattrPAXPrefix = "SCHILY.xattr."
+
+// validate checks the Tar options.
+func (o *TarOptions) validate() error {
+	switch o.Format {
+	case tar.FormatUnknown, tar.FormatUSTAR, tar.FormatPAX, tar.FormatGNU:
+	default:
+		return fmt.Errorf("archive/tar: unsupported header format %v", o.Format)
+	}
+	if o.Sparse && o.Format != tar.FormatUnknown && o.Format != tar.FormatPAX {
+		return fmt.Errorf("archive/tar: sparse files can't be represented in %v format", o.Format)
+	}
+	if err := o.Gzip.validate(); err != nil {
+		return err
+	}
+	if err := o.Special.validate(); err != nil {
+		return err
+	}
+	if err := o.Ownership.validate(); err != nil {
+		return err
+	}
+	return o.Overrides.validate()
+}
+
+// writeTarHeader applies the options to the Tar header of a file and writes it.
+func writeTarHeader(tw *tar.Writer, h *tar.Header, file string, opts *TarOptions) error {
+	if err := prepareTarHeader(h, file, opts); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(h); err != nil {
+		if opts.Format != tar.FormatUnknown {
+			return fmt.Errorf("archive/tar: entry %q can't be represented in %v format: %w", h.Name, opts.Format, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// prepareTarHeader applies the options to the Tar header of a file.
+func prepareTarHeader(h *tar.Header, file string, opts *TarOptions) error {
+	if opts.Xattrs {
+		xattrs, err := readXattrs(file)
+		if err != nil {
+			return fmt.Errorf("archive/tar: can't read extended attributes of %s: %w", file, err)
+		}
+		for name, value := range xattrs {
+			if h.PAXRecords == nil {
+				h.PAXRecords = map[string]string{}
+			}
+			h.PAXRecords[xattrPAXPrefix+name] = value
+		}
+	}
+	opts.Ownership.apply(h)
+	opts.Overrides.applyTar(h)
+	// Access and change times are never archived and only PAX stores sub-second modification times
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	if opts.Format != tar.FormatUnknown {
+		h.Format = opts.Format
+		if opts.Format != tar.FormatPAX {
+			h.ModTime = h.ModTime.Truncate(time.Second)
+		}
+	}
+	return nil
+}
+
 // CreateTarballBytes archives a file or directory src using Tar and Gzip compression.
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateTarballBytes(basePath string, src string, outBuf io.Writer) error {
+	return CreateTarballBytesWithOptions(basePath, src, outBuf, TarOptions{})
+}
+
+// CreateTarballBytesWithOptions archives a file or directory src using Tar and Gzip compression with the given options.
+// basePath param specify the base path directory of src path which will be skipped for each archive file header.
+// Otherwise if basePath param is empty then only src path will taken into account.
+func CreateTarballBytesWithOptions(basePath string, src string, outBuf io.Writer, opts TarOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
 	zw := gzip.NewWriter(outBuf)
+	opts.Gzip.apply(zw)
 	tw := tar.NewWriter(zw)
 	src = strings.TrimSpace(src)
 	basePath = strings.TrimSpace(basePath)
@@ -32,23 +153,28 @@ func CreateTarballBytes(basePath string, src string, outBuf io.Writer) error {
 	}
 	fm := fi.Mode()
 	switch {
-	case fm.IsRegular():
-		// Get Tar source file header
-		h, err := tar.FileInfoHeader(fi, src)
+	case fm&(os.ModeNamedPipe|os.ModeDevice|os.ModeSocket) != 0:
+		archived, err := opts.Special.check(src, fm)
 		if err != nil {
 			return err
 		}
-		// Write Tar source file header
-		if err := tw.WriteHeader(h); err != nil {
-			return err
+		if archived {
+			h, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			if err := writeTarHeader(tw, h, src, &opts); err != nil {
+				return err
+			}
 		}
-		// Get source file content
-		f, err := os.Open(src)
-		defer f.Close()
+	case fm.IsRegular():
+		// Get Tar source file header
+		h, err := tar.FileInfoHeader(fi, src)
 		if err != nil {
 			return err
 		}
-		if _, err := io.Copy(tw, f); err != nil {
+		// Write Tar source file header and content
+		if err := writeTarFile(tw, zw, h, src, &opts); err != nil {
 			return err
 		}
 	case fi.IsDir():
@@ -59,10 +185,33 @@ func CreateTarballBytes(basePath string, src string, outBuf io.Writer) error {
 				return err
 			}
 		}
+		// Archive names of files having several hard links by device and inode
+		hardlinks := map[fileID]string{}
 		// Traversing the directory tree on a file system
-		filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+		err = filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if isExcluded(fi, opts.Exclude) {
+				return nil
+			}
+			// Symbolic links are archived as links and never followed
+			link := ""
+			if fi.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(file); err != nil {
+					return err
+				}
+			}
+			// Special files are archived, skipped or rejected according to their policy
+			archived, err := opts.Special.check(file, fi.Mode())
+			if err != nil {
+				return err
+			}
+			if !archived {
+				return nil
+			}
 			// Create a Tar file header
-			h, err := tar.FileInfoHeader(fi, file)
+			h, err := tar.FileInfoHeader(fi, link)
 			if err != nil {
 				return err
 			}
@@ -83,23 +232,26 @@ func CreateTarballBytes(basePath string, src string, outBuf io.Writer) error {
 			// to provide the full path name of the file.
 			// https://golang.org/src/archive/tar/common.go?#L626
 			h.Name = filepath.ToSlash(fileName)
-			// Write Tar header
-			if err := tw.WriteHeader(h); err != nil {
-				return err
-			}
-			// If it's not a directory, write file content instead
-			if !fi.IsDir() {
-				f, err := os.Open(file)
-				defer f.Close()
-				if err != nil {
-					return err
-				}
-				if _, err := io.Copy(tw, f); err != nil {
-					return err
+			// Subsequent occurrences of a hard linked file only refer to the first one
+			if id, ok := hardlinkID(fi); ok {
+				if first, ok := hardlinks[id]; ok {
+					h.Typeflag = tar.TypeLink
+					h.Linkname = first
+					h.Size = 0
+				} else {
+					hardlinks[id] = h.Name
 				}
 			}
-			return nil
+			// If it's a regular file, write file content too
+			if h.Typeflag == tar.TypeReg {
+				return writeTarFile(tw, zw, h, file, &opts)
+			}
+			// Write Tar header
+			return writeTarHeader(tw, h, file, &opts)
 		})
+		if err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("archive/tar: unknown file mode %v", fm)
 	}
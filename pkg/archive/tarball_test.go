@@ -1,11 +1,16 @@
 package archive
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateTarballBytes(t *testing.T) {
@@ -123,3 +128,173 @@ func TestCreateTarballBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateTarballBytesWithOptionsFormat(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	mtime := time.Date(2021, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	mkFile := func(name string) string {
+		dir := filepath.Join(tmpDirPath, strings.Replace(name, "/", "_", -1)+"-src")
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return dir
+	}
+	longName := strings.Repeat("n", 101) + ".txt"
+	tests := []struct {
+		name       string
+		file       string
+		format     tar.Format
+		wantFormat tar.Format
+		wantNanos  bool
+		wantErr    string
+	}{
+		{name: "ustar", file: "file.txt", format: tar.FormatUSTAR, wantFormat: tar.FormatUSTAR},
+		{name: "ustar split long path", file: strings.Repeat("d", 90) + "/" + strings.Repeat("f", 90), format: tar.FormatUSTAR, wantFormat: tar.FormatUSTAR},
+		{name: "pax keeps sub-second modification times", file: "file.txt", format: tar.FormatPAX, wantFormat: tar.FormatPAX, wantNanos: true},
+		{name: "gnu long name", file: longName, format: tar.FormatGNU, wantFormat: tar.FormatGNU},
+		{name: "pax long name", file: longName, format: tar.FormatPAX, wantFormat: tar.FormatPAX, wantNanos: true},
+		{name: "ustar long name", file: longName, format: tar.FormatUSTAR, wantErr: `archive/tar: entry "` + longName + `" can't be represented in USTAR format`},
+		{name: "ustar non-ASCII name", file: "résumé.txt", format: tar.FormatUSTAR, wantErr: `archive/tar: entry "résumé.txt" can't be represented in USTAR format`},
+		{name: "unsupported format", file: "file.txt", format: tar.Format(1), wantErr: "archive/tar: unsupported header format V7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := mkFile(tt.file)
+			outBuf := &bytes.Buffer{}
+			err := CreateTarballBytesWithOptions(dir, filepath.FromSlash(tt.file), outBuf, TarOptions{Format: tt.format})
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("CreateTarballBytesWithOptions() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateTarballBytesWithOptions() error = %v", err)
+			}
+			zr, err := gzip.NewReader(outBuf)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			h, err := tar.NewReader(zr).Next()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if h.Format != tt.wantFormat {
+				t.Errorf("CreateTarballBytesWithOptions() format = %v, want %v", h.Format, tt.wantFormat)
+			}
+			if got := h.ModTime.Nanosecond() != 0; got != tt.wantNanos {
+				t.Errorf("CreateTarballBytesWithOptions() mtime = %v, want sub-second %v", h.ModTime, tt.wantNanos)
+			}
+		})
+	}
+
+	// Sizes over 8 GiB only fit PAX and GNU headers
+	for _, format := range []tar.Format{tar.FormatUSTAR, tar.FormatPAX, tar.FormatGNU} {
+		h := &tar.Header{Name: "huge.bin", Typeflag: tar.TypeReg, Mode: 0644, Size: 1 << 34}
+		err := writeTarHeader(tar.NewWriter(ioutil.Discard), h, "", &TarOptions{Format: format})
+		if (err != nil) != (format == tar.FormatUSTAR) {
+			t.Errorf("writeTarHeader() %v error = %v", format, err)
+		}
+	}
+}
+
+func TestCreateTarballBytesHardlinks(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// A multi-call binary linked under several names
+	bin := filepath.Join(tmpDirPath, "rootfs", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	content := bytes.Repeat([]byte("busybox"), 4096)
+	if err := ioutil.WriteFile(filepath.Join(bin, "busybox"), content, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, name := range []string{"ls", "sh"} {
+		if err := os.Link(filepath.Join(bin, "busybox"), filepath.Join(bin, name)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(bin, "other"), content, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	outBuf := &bytes.Buffer{}
+	if err := CreateTarballBytes(tmpDirPath, "rootfs", outBuf); err != nil {
+		t.Fatalf("CreateTarballBytes() error = %v", err)
+	}
+	data := outBuf.Bytes()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Only busybox and other carry the content
+	if max := 2*len(content) + 16*512; len(raw) > max {
+		t.Errorf("CreateTarballBytes() tar size = %d, want at most %d", len(raw), max)
+	}
+
+	r, err := NewTarballReader(bytes.NewReader(data), Limits{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	links := map[string]string{}
+	for {
+		e, err := r.Next()
+		if err != nil {
+			break
+		}
+		if e.Tar.Typeflag == tar.TypeLink {
+			links[e.Name] = e.Linkname
+		}
+	}
+	want := map[string]string{"rootfs/bin/ls": "rootfs/bin/busybox", "rootfs/bin/sh": "rootfs/bin/busybox"}
+	if len(links) != len(want) || links["rootfs/bin/ls"] != want["rootfs/bin/ls"] || links["rootfs/bin/sh"] != want["rootfs/bin/sh"] {
+		t.Errorf("CreateTarballBytes() hard links = %v, want %v", links, want)
+	}
+
+	// Link structure survives extraction
+	r, err = NewTarballReader(bytes.NewReader(data), Limits{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dst := filepath.Join(tmpDirPath, "dst")
+	if err := r.Extract(dst); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	busybox, err := os.Stat(filepath.Join(dst, "rootfs", "bin", "busybox"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, name := range []string{"ls", "sh", "other"} {
+		fi, err := os.Stat(filepath.Join(dst, "rootfs", "bin", name))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if os.SameFile(busybox, fi) != (name != "other") {
+			t.Errorf("Extract() %s same file as busybox = %v", name, os.SameFile(busybox, fi))
+		}
+		if fi.Size() != int64(len(content)) {
+			t.Errorf("Extract() %s size = %d, want %d", name, fi.Size(), len(content))
+		}
+	}
+}
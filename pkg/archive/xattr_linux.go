@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs reads the extended attributes of a file without following symbolic links.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+	xattrs := map[string]string{}
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getXattr(path, string(name))
+		if err != nil {
+			// Attributes may vanish between listing and reading
+			if errors.Is(err, unix.ENODATA) {
+				continue
+			}
+			return nil, err
+		}
+		xattrs[string(name)] = string(value)
+	}
+	return xattrs, nil
+}
+
+func getXattr(path string, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Lgetxattr(path, name, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// writeXattr sets an extended attribute of a file without following symbolic links.
+func writeXattr(path string, name string, value string) error {
+	return unix.Lsetxattr(path, name, []byte(value), 0)
+}
+
+// isXattrNotPermitted reports whether an extended attribute can't be restored due to missing
+// privileges (e.g. `trusted.*` or `security.*` attributes) or file system support.
+func isXattrNotPermitted(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) || errors.Is(err, unix.ENOTSUP)
+}
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTarballXattrs(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	src := filepath.Join(tmpDirPath, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	file := filepath.Join(src, "server")
+	if err := ioutil.WriteFile(file, []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := unix.Lsetxattr(file, "user.comment", []byte("compactor"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			t.Skipf("user extended attributes not supported: %v", err)
+		}
+		t.Fatalf("%v", err)
+	}
+	want := map[string]string{"user.comment": "compactor"}
+	// cap_net_bind_service=ep (VFS_CAP_REVISION_2) only when privileged
+	capability := string([]byte{0x01, 0x00, 0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if err := unix.Lsetxattr(file, "security.capability", []byte(capability), 0); err == nil {
+		want["security.capability"] = capability
+	}
+
+	outBuf := &bytes.Buffer{}
+	if err := CreateTarballBytesWithOptions(tmpDirPath, "src", outBuf, TarOptions{Xattrs: true}); err != nil {
+		t.Fatalf("CreateTarballBytesWithOptions() error = %v", err)
+	}
+	data := outBuf.Bytes()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if h.Name != "src/server" {
+			continue
+		}
+		if h.Format != tar.FormatPAX {
+			t.Errorf("CreateTarballBytesWithOptions() format = %v, want %v", h.Format, tar.FormatPAX)
+		}
+		for name, value := range want {
+			if got := h.PAXRecords[xattrPAXPrefix+name]; got != value {
+				t.Errorf("CreateTarballBytesWithOptions() %s = %q, want %q", name, got, value)
+			}
+		}
+		break
+	}
+
+	tests := []struct {
+		name string
+		opts ExtractOptions
+		want map[string]string
+	}{
+		{name: "restore extended attributes", opts: ExtractOptions{Xattrs: true}, want: want},
+		{name: "ignore extended attributes", want: map[string]string{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewTarballReader(bytes.NewReader(data), Limits{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dst := filepath.Join(tmpDirPath, "dst", string(rune('a'+i)))
+			if err := r.ExtractWithOptions(dst, tt.opts); err != nil {
+				t.Fatalf("ExtractWithOptions() error = %v", err)
+			}
+			got, err := readXattrs(filepath.Join(dst, "src", "server"))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("ExtractWithOptions() %s = %q, want %q", name, got[name], value)
+				}
+			}
+			if _, ok := got["user.comment"]; ok != (len(tt.want) > 0) {
+				t.Errorf("ExtractWithOptions() extended attributes = %q", got)
+			}
+		})
+	}
+
+	// Extended attributes can only be stored as PAX records
+	err = CreateTarballBytesWithOptions(tmpDirPath, "src", ioutil.Discard, TarOptions{Xattrs: true, Format: tar.FormatUSTAR})
+	if err == nil {
+		t.Errorf("CreateTarballBytesWithOptions() error = %v, want USTAR format error", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package archive
+
+import "errors"
+
+var errXattrUnsupported = errors.New("archive: extended attributes are only supported on Linux")
+
+func readXattrs(path string) (map[string]string, error) {
+	return nil, errXattrUnsupported
+}
+
+func writeXattr(path string, name string, value string) error {
+	return errXattrUnsupported
+}
+
+func isXattrNotPermitted(err error) bool {
+	return err == errXattrUnsupported
+}
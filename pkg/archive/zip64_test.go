@@ -0,0 +1,231 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sparseBufferBlock is the sparseBuffer allocation unit.
+const sparseBufferBlock = 64 << 10
+
+// sparseBuffer is an in-memory file which doesn't allocate zero blocks so multi-GiB archives of holes fit in memory.
+type sparseBuffer struct {
+	blocks map[int64][]byte
+	size   int64
+}
+
+func (b *sparseBuffer) Write(p []byte) (int, error) {
+	if b.blocks == nil {
+		b.blocks = map[int64][]byte{}
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i, off := b.size/sparseBufferBlock, int(b.size%sparseBufferBlock)
+		chunk := p
+		if len(chunk) > sparseBufferBlock-off {
+			chunk = chunk[:sparseBufferBlock-off]
+		}
+		block, ok := b.blocks[i]
+		if !ok && !isZero(chunk) {
+			block = make([]byte, sparseBufferBlock)
+			b.blocks[i] = block
+		}
+		if block != nil {
+			copy(block[off:], chunk)
+		}
+		b.size += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+func (b *sparseBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && off < b.size {
+		i, boff := off/sparseBufferBlock, int(off%sparseBufferBlock)
+		chunk := p[n:]
+		if len(chunk) > sparseBufferBlock-boff {
+			chunk = chunk[:sparseBufferBlock-boff]
+		}
+		if rest := b.size - off; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		if block, ok := b.blocks[i]; ok {
+			copy(chunk, block[boff:])
+		} else {
+			for j := range chunk {
+				chunk[j] = 0
+			}
+		}
+		n += len(chunk)
+		off += int64(len(chunk))
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestCreateZipballBytesZip64LargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("archives more than 4 GiB")
+	}
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// A database dump over 4 GiB made of holes so it takes no disk space
+	src := filepath.Join(tmpDirPath, "dumps")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	const size int64 = 4<<30 + 1<<20
+	f, err := os.Create(filepath.Join(src, "db.dump"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := f.WriteAt([]byte("head"), 0); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := f.WriteAt([]byte("tail"), size-4); err != nil {
+		t.Fatalf("%v", err)
+	}
+	f.Close()
+	// Written after the dump so its local header offset is over 4 GiB too
+	if err := ioutil.WriteFile(filepath.Join(src, "readme.txt"), []byte("dump of 2020-09-13"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out := &sparseBuffer{}
+	opts := ZipOptions{Methods: Methods{{Pattern: "*.dump", Method: zip.Store}}}
+	if err := CreateZipballBytesWithOptions(tmpDirPath, "dumps", out, opts); err != nil {
+		t.Fatalf("CreateZipballBytesWithOptions() error = %v", err)
+	}
+	if err := TestZipballBytes(out, out.size); err != nil {
+		t.Fatalf("TestZipballBytes() error = %v", err)
+	}
+	zr, err := zip.NewReader(out, out.size)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	entries, err := readZipCentralDirectory(out, out.size)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i, f := range zr.File {
+		switch f.Name {
+		case "dumps/db.dump":
+			if f.UncompressedSize64 != uint64(size) || f.CompressedSize64 != uint64(size) {
+				t.Errorf("CreateZipballBytesWithOptions() %s sizes = %d/%d, want %d", f.Name, f.CompressedSize64, f.UncompressedSize64, size)
+			}
+			// Streamed entries carry their sizes in a data descriptor
+			if f.Flags&0x8 == 0 {
+				t.Errorf("CreateZipballBytesWithOptions() %s has no data descriptor", f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			head := make([]byte, 4)
+			if _, err := io.ReadFull(rc, head); err != nil || string(head) != "head" {
+				t.Errorf("CreateZipballBytesWithOptions() %s starts with %q, %v", f.Name, head, err)
+			}
+			rc.Close()
+		case "dumps/readme.txt":
+			if entries[i].offset <= 4<<30 {
+				t.Errorf("CreateZipballBytesWithOptions() %s offset = %d, want over 4 GiB", f.Name, entries[i].offset)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(data) != "dump of 2020-09-13" {
+				t.Errorf("CreateZipballBytesWithOptions() %s = %q, %v", f.Name, data, err)
+			}
+		}
+	}
+	if !hasZip64End(t, out, out.size) {
+		t.Errorf("CreateZipballBytesWithOptions() has no Zip64 end of central directory")
+	}
+}
+
+func TestCreateZipballBytesZip64Entries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("archives more than 65,535 files")
+	}
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	const files = 1<<16 + 10
+	src := filepath.Join(tmpDirPath, "many")
+	for i := 0; i < files; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("%03d", i/1000))
+		if i%1000 == 0 {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.txt", i)), nil, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := CreateZipballBytes(tmpDirPath, "many", out); err != nil {
+		t.Fatalf("CreateZipballBytes() error = %v", err)
+	}
+	data := bytes.NewReader(out.Bytes())
+	if err := TestZipballBytes(data, data.Size()); err != nil {
+		t.Fatalf("TestZipballBytes() error = %v", err)
+	}
+	r, err := NewZipballReader(data, data.Size(), Limits{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n := 0
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if e.Mode.IsRegular() {
+			n++
+		}
+	}
+	if n != files {
+		t.Errorf("CreateZipballBytes() files = %d, want %d", n, files)
+	}
+	if !hasZip64End(t, data, data.Size()) {
+		t.Errorf("CreateZipballBytes() has no Zip64 end of central directory")
+	}
+}
+
+// hasZip64End reports whether a Zip archive has a Zip64 end of central directory locator.
+func hasZip64End(t *testing.T, r io.ReaderAt, size int64) bool {
+	// The locator directly precedes the end of central directory record (without archive comment)
+	locator := make([]byte, 4)
+	if _, err := r.ReadAt(locator, size-22-20); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return binary.LittleEndian.Uint32(locator) == 0x07064b50
+}
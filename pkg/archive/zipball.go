@@ -4,16 +4,114 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// zipCreatorUnix is the "version made by" upper byte telling unzip tools that external attributes hold Unix modes.
+const zipCreatorUnix = 3
+
+// zipVersion20 is the "version made by" lower byte (Zip specification 2.0).
+const zipVersion20 = 20
+
+// zipFileInfoHeader creates a Zip file header for a file, directory or symbolic link named name.
+// Unix modes (file type, permissions and exec bits) are stored in the upper 16 bits of the external attributes
+// and MS-DOS attributes in the lower ones, as the Info-ZIP tools do.
+// The compression method is set here since it can't be changed once the header is written.
+func zipFileInfoHeader(fi os.FileInfo, name string) (*zip.FileHeader, error) {
+	h, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return nil, err
+	}
+	h.Name = filepath.ToSlash(name)
+	h.SetMode(fi.Mode())
+	h.CreatorVersion = zipCreatorUnix<<8 | zipVersion20
+	switch {
+	case fi.IsDir():
+		h.Name = strings.TrimSuffix(h.Name, "/") + "/"
+		h.Method = zip.Store
+	case fi.Mode()&os.ModeSymlink != 0:
+		// The link target is stored as content
+		h.Method = zip.Store
+	default:
+		h.Method = zip.Deflate
+	}
+	return h, nil
+}
+
+// ZipOptions represents the Zip archive creation options.
+type ZipOptions struct {
+	// Overrides are glob rules overriding modes, modification times and, with UnixOwner, owners of matching entries.
+	Overrides Overrides
+	// Comment is the archive comment (e.g. version, commit and build URL).
+	Comment string
+	// Comments are entry comments by slash-separated entry name (directories without trailing slash).
+	Comments map[string]string
+	// ExtendedTime stores the access time next to the modification time in the Info-ZIP extended timestamp
+	// extra field (0x5455). Access times are only read on Unix.
+	ExtendedTime bool
+	// UnixOwner stores the entry uid and gid in the Info-ZIP Unix extra field (0x7875). Ownership is only read on Unix.
+	UnixOwner bool
+	// Ownership controls the uid and gid stored with UnixOwner. Zip entries carry no user and group names.
+	Ownership OwnerOptions
+	// Methods are glob rules choosing the compression method of matching regular files (e.g. `StoreCompressed`).
+	// Files not matching any rule are deflated.
+	Methods Methods
+	// MinDeflateGain makes files not matching any method rule stored instead of deflated
+	// when deflating their first 64 KiB saves less than this ratio (e.g. 0.05 for 5%).
+	// Zero always deflates them.
+	MinDeflateGain float64
+	// CP437Names writes non-ASCII entry names and comments representable in IBM Code Page 437 in that encoding
+	// without the UTF-8 flag for old unzip tools. Other non-ASCII names are always written in UTF-8 with the flag set.
+	CP437Names bool
+	// Exclude are files left out of the archive, compared with `os.SameFile` (e.g. the archive being written inside src).
+	Exclude []os.FileInfo
+}
+
+// validate checks the Zip options.
+func (o *ZipOptions) validate() error {
+	if len(o.Comment) > math.MaxUint16 {
+		return fmt.Errorf("archive/zip: archive comment too long")
+	}
+	for name, comment := range o.Comments {
+		if len(comment) > math.MaxUint16 {
+			return fmt.Errorf("archive/zip: comment of %q too long", name)
+		}
+	}
+	if o.MinDeflateGain < 0 || o.MinDeflateGain > 1 {
+		return fmt.Errorf("archive/zip: minimum deflate gain %v out of range", o.MinDeflateGain)
+	}
+	if err := o.Methods.validate(); err != nil {
+		return err
+	}
+	if err := o.Ownership.validate(); err != nil {
+		return err
+	}
+	return o.Overrides.validate()
+}
+
 // CreateZipballBytes archives a file or directory (src path) using Zip.
 // basePath param specify the base path directory of src path which will be skipped for each archive file header.
 // Otherwise if basePath param is empty then only src path will taken into account.
 func CreateZipballBytes(basePath string, src string, outBuf io.Writer) error {
+	return CreateZipballBytesWithOptions(basePath, src, outBuf, ZipOptions{})
+}
+
+// CreateZipballBytesWithOptions archives a file or directory (src path) using Zip with the given options.
+// Entries are streamed with data descriptors and Zip64 records are written once sizes, offsets or the entry count
+// exceed the Zip limits (4 GiB and 65,535 entries).
+// basePath param specify the base path directory of src path which will be skipped for each archive file header.
+// Otherwise if basePath param is empty then only src path will taken into account.
+func CreateZipballBytesWithOptions(basePath string, src string, outBuf io.Writer, opts ZipOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
 	zw := zip.NewWriter(outBuf)
+	if err := zw.SetComment(opts.Comment); err != nil {
+		return err
+	}
 	src = strings.TrimSpace(src)
 	basePath = strings.TrimSpace(basePath)
 	if basePath != "" {
@@ -31,22 +129,29 @@ func CreateZipballBytes(basePath string, src string, outBuf io.Writer) error {
 	switch {
 	case fm.IsRegular():
 		// Get Zip source file header
-		h, err := zip.FileInfoHeader(fi)
+		h, err := zipFileInfoHeader(fi, fi.Name())
 		if err != nil {
 			return err
 		}
+		opts.Overrides.applyZip(h)
+		if err := opts.applyZipExtra(h, src); err != nil {
+			return err
+		}
+		if err := opts.chooseMethod(h, src); err != nil {
+			return err
+		}
+		opts.applyZipName(h)
 		// Write Zip source file header
 		hw, err := zw.CreateHeader(h)
 		if err != nil {
 			return err
 		}
-		h.Method = zip.Deflate
 		// Get source file content
 		f, err := os.Open(src)
-		defer f.Close()
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 		if _, err := io.Copy(hw, f); err != nil {
 			return err
 		}
@@ -59,12 +164,13 @@ func CreateZipballBytes(basePath string, src string, outBuf io.Writer) error {
 			}
 		}
 		// Traversing the directory tree on a file system
-		filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
-			// Create a Zip file header
-			h, err := zip.FileInfoHeader(fi)
+		err = filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
+			if isExcluded(fi, opts.Exclude) {
+				return nil
+			}
 			// Base path file support
 			fileName := file
 			if basePathAbs != "" {
@@ -77,30 +183,50 @@ func CreateZipballBytes(basePath string, src string, outBuf io.Writer) error {
 				}
 				fileName = p
 			}
-			h.Name = filepath.ToSlash(fileName)
-			if fi.IsDir() {
-				h.Name += "/"
-			} else {
-				h.Method = zip.Deflate
+			// Create a Zip file header
+			h, err := zipFileInfoHeader(fi, fileName)
+			if err != nil {
+				return err
 			}
+			opts.Overrides.applyZip(h)
+			if err := opts.applyZipExtra(h, file); err != nil {
+				return err
+			}
+			if err := opts.chooseMethod(h, file); err != nil {
+				return err
+			}
+			opts.applyZipName(h)
 			// Write Zip header
 			hw, err := zw.CreateHeader(h)
 			if err != nil {
 				return err
 			}
-			// If it's not a directory, write file content instead
-			if !fi.IsDir() {
+			// Symbolic links are archived as links (target path as content) and never followed
+			if fi.Mode()&os.ModeSymlink != 0 {
+				link, err := os.Readlink(file)
+				if err != nil {
+					return err
+				}
+				if _, err := io.WriteString(hw, filepath.ToSlash(link)); err != nil {
+					return err
+				}
+			}
+			// If it's a regular file, write file content instead
+			if fi.Mode().IsRegular() {
 				f, err := os.Open(file)
-				defer f.Close()
 				if err != nil {
 					return err
 				}
+				defer f.Close()
 				if _, err := io.Copy(hw, f); err != nil {
 					return err
 				}
 			}
 			return nil
 		})
+		if err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("archive/zip: unknown file mode %v", fm)
 	}
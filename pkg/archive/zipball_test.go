@@ -1,10 +1,12 @@
 package archive
 
 import (
+	"archive/zip"
 	"bytes"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -123,3 +125,122 @@ func TestCreateZipballBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateZipballBytesModes(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	src := filepath.Join(tmpDirPath, "src")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	files := map[string]os.FileMode{
+		"bin/cli":    0755,
+		"readme.txt": 0644,
+		"secret.txt": 0600,
+		"ro.txt":     0444,
+	}
+	for name, mode := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := ioutil.WriteFile(p, []byte(name), mode); err != nil {
+			t.Fatalf("%v", err)
+		}
+		// Ignore the process umask
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "bin"), 0750); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.Symlink("bin/cli", filepath.Join(src, "cli")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	outBuf := &bytes.Buffer{}
+	if err := CreateZipballBytes(tmpDirPath, "src", outBuf); err != nil {
+		t.Fatalf("CreateZipballBytes() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(outBuf.Bytes()), int64(outBuf.Len()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tests := []struct {
+		name       string
+		wantMode   os.FileMode
+		wantMethod uint16
+		wantBody   string
+	}{
+		{name: "src/", wantMode: os.ModeDir | 0755, wantMethod: zip.Store},
+		{name: "src/bin/", wantMode: os.ModeDir | 0750, wantMethod: zip.Store},
+		{name: "src/bin/cli", wantMode: 0755, wantMethod: zip.Deflate, wantBody: "bin/cli"},
+		{name: "src/readme.txt", wantMode: 0644, wantMethod: zip.Deflate, wantBody: "readme.txt"},
+		{name: "src/secret.txt", wantMode: 0600, wantMethod: zip.Deflate, wantBody: "secret.txt"},
+		{name: "src/ro.txt", wantMode: 0444, wantMethod: zip.Deflate, wantBody: "ro.txt"},
+		{name: "src/cli", wantMode: os.ModeSymlink | 0777, wantMethod: zip.Store, wantBody: "bin/cli"},
+	}
+	headers := map[string]*zip.File{}
+	for _, f := range zr.File {
+		headers[f.Name] = f
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := headers[tt.name]
+			if !ok {
+				t.Fatalf("CreateZipballBytes() entry %s not found", tt.name)
+			}
+			if creator := f.CreatorVersion >> 8; creator != zipCreatorUnix {
+				t.Errorf("CreateZipballBytes() creator = %d, want %d", creator, zipCreatorUnix)
+			}
+			if f.Mode() != tt.wantMode {
+				t.Errorf("CreateZipballBytes() mode = %v, want %v", f.Mode(), tt.wantMode)
+			}
+			if f.Method != tt.wantMethod {
+				t.Errorf("CreateZipballBytes() method = %d, want %d", f.Method, tt.wantMethod)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer rc.Close()
+			body, err := ioutil.ReadAll(rc)
+			if err != nil || string(body) != tt.wantBody {
+				t.Errorf("CreateZipballBytes() content = %q, %v, want %q", body, err, tt.wantBody)
+			}
+		})
+	}
+
+	// Single files are compressed too
+	outBuf.Reset()
+	if err := CreateZipballBytes(src, "bin/cli", outBuf); err != nil {
+		t.Fatalf("CreateZipballBytes() error = %v", err)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(outBuf.Bytes()), int64(outBuf.Len()))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if f := zr.File[0]; f.Method != zip.Deflate || f.Mode() != 0755 {
+		t.Errorf("CreateZipballBytes() single file method = %d, mode = %v", f.Method, f.Mode())
+	}
+
+	// The exec bit survives unzip tools
+	zipFile := filepath.Join(tmpDirPath, "cli.zip")
+	if err := ioutil.WriteFile(zipFile, outBuf.Bytes(), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	dst := filepath.Join(tmpDirPath, "dst")
+	if out, err := exec.Command("unzip", "-o", "-qq", zipFile, "-d", dst).CombinedOutput(); err != nil {
+		t.Fatalf("unzip: %v: %s", err, out)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "cli"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if fi.Mode()&0100 == 0 {
+		t.Errorf("unzip mode = %v, want owner exec bit", fi.Mode())
+	}
+}
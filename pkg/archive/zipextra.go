@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// Info-ZIP extra field ids (https://libzip.org/specifications/extrafld.txt)
+const (
+	zipExtTimeExtraID   = 0x5455
+	zipUnixOwnerExtraID = 0x7875
+)
+
+// applyZipExtra sets the entry comment and the Info-ZIP extra fields of a Zip header once overrides are applied.
+func (o *ZipOptions) applyZipExtra(h *zip.FileHeader, file string) error {
+	h.Comment = o.Comments[strings.TrimSuffix(h.Name, "/")]
+	if !o.ExtendedTime && !o.UnixOwner {
+		return nil
+	}
+	st, err := lstatUnix(file)
+	if err != nil {
+		return err
+	}
+	if o.ExtendedTime && !h.Modified.IsZero() {
+		var atime time.Time
+		if st != nil {
+			atime = st.atime
+		}
+		h.Extra = append(h.Extra, zipExtTimeExtra(h.Modified, atime)...)
+		// The MS-DOS date and time are still set but the Zip writer mustn't add its own extended timestamp
+		h.ModifiedDate, h.ModifiedTime = msDosTime(h.Modified)
+		h.Modified = time.Time{}
+	}
+	if o.UnixOwner && st != nil {
+		uid, gid := st.uid, st.gid
+		if owner := o.Overrides.resolve(h.Name).Owner; owner != nil {
+			uid, gid = owner.UID, owner.GID
+		} else {
+			uid, gid = o.Ownership.ids(uid, gid)
+		}
+		h.Extra = append(h.Extra, zipUnixOwnerExtra(uid, gid)...)
+	}
+	return nil
+}
+
+// zipExtTimeExtra encodes an extended timestamp extra field holding the modification and the optional access times.
+// The Zip writer copies extra fields to the central directory too, where Info-ZIP only reads the modification time.
+func zipExtTimeExtra(mtime time.Time, atime time.Time) []byte {
+	flags := byte(1)
+	size := 5
+	if !atime.IsZero() {
+		flags |= 2
+		size += 4
+	}
+	b := make([]byte, 4+size)
+	binary.LittleEndian.PutUint16(b[0:], zipExtTimeExtraID)
+	binary.LittleEndian.PutUint16(b[2:], uint16(size))
+	b[4] = flags
+	binary.LittleEndian.PutUint32(b[5:], uint32(mtime.Unix()))
+	if !atime.IsZero() {
+		binary.LittleEndian.PutUint32(b[9:], uint32(atime.Unix()))
+	}
+	return b
+}
+
+// zipUnixOwnerExtra encodes a Unix extra field (version 1) holding 32-bit uid and gid.
+func zipUnixOwnerExtra(uid int, gid int) []byte {
+	b := make([]byte, 4+11)
+	binary.LittleEndian.PutUint16(b[0:], zipUnixOwnerExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 11)
+	b[4] = 1
+	b[5] = 4
+	binary.LittleEndian.PutUint32(b[6:], uint32(uid))
+	b[10] = 4
+	binary.LittleEndian.PutUint32(b[11:], uint32(gid))
+	return b
+}
+
+// msDosTime converts a time to MS-DOS date and time fields with a two-second precision.
+func msDosTime(t time.Time) (uint16, uint16) {
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
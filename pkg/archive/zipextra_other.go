@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package archive
+
+import "time"
+
+// unixStat represents the file ownership and access time.
+type unixStat struct {
+	uid   int
+	gid   int
+	atime time.Time
+}
+
+// lstatUnix never finds Unix ownership and access times on other platforms.
+func lstatUnix(file string) (*unixStat, error) {
+	return nil, nil
+}
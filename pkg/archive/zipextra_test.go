@@ -0,0 +1,153 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipExtraFields splits a Zip extra field into its blocks by id.
+func zipExtraFields(extra []byte) map[uint16][][]byte {
+	fields := map[uint16][][]byte{}
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		fields[id] = append(fields[id], extra[4:4+size])
+		extra = extra[4+size:]
+	}
+	return fields
+}
+
+func TestCreateZipballBytesExtra(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	src := filepath.Join(tmpDirPath, "release")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	file := filepath.Join(src, "notes.txt")
+	if err := ioutil.WriteFile(file, []byte("notes"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	atime := time.Unix(1500000000, 0)
+	mtime := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name      string
+		opts      ZipOptions
+		wantAtime bool
+		wantUID   int
+		wantGID   int
+		wantOwner bool
+		wantErr   bool
+	}{
+		{
+			name: "comments",
+			opts: ZipOptions{
+				Comment:  "v1.2.0 commit 365efde https://ci.example.com/builds/42",
+				Comments: map[string]string{"release": "release directory", "release/notes.txt": "release notes"},
+			},
+		},
+		{
+			name:      "extended timestamp",
+			opts:      ZipOptions{ExtendedTime: true},
+			wantAtime: runtime.GOOS != "windows",
+		},
+		{
+			name: "forced unix owner",
+			opts: ZipOptions{
+				UnixOwner: true,
+				Ownership: OwnerOptions{Owner: &Owner{UID: 0, GID: 0}},
+			},
+			wantOwner: runtime.GOOS != "windows",
+		},
+		{
+			name: "overridden unix owner",
+			opts: ZipOptions{
+				UnixOwner: true,
+				Ownership: OwnerOptions{Owner: &Owner{UID: 0, GID: 0}},
+				Overrides: Overrides{{Pattern: "*.txt", Owner: &Owner{UID: 1000, GID: 100}}},
+			},
+			wantUID:   1000,
+			wantGID:   100,
+			wantOwner: runtime.GOOS != "windows",
+		},
+		{
+			name:    "archive comment too long",
+			opts:    ZipOptions{Comment: strings.Repeat("c", 1<<16)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Access times are updated by every archiving
+			if err := os.Chtimes(file, atime, mtime); err != nil {
+				t.Fatalf("%v", err)
+			}
+			outBuf := &bytes.Buffer{}
+			err := CreateZipballBytesWithOptions(tmpDirPath, "release", outBuf, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateZipballBytesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			data := outBuf.Bytes()
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if zr.Comment != tt.opts.Comment {
+				t.Errorf("CreateZipballBytesWithOptions() comment = %q, want %q", zr.Comment, tt.opts.Comment)
+			}
+			r, err := NewZipballReader(bytes.NewReader(data), int64(len(data)), Limits{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if r.Comment() != tt.opts.Comment {
+				t.Errorf("Reader.Comment() = %q, want %q", r.Comment(), tt.opts.Comment)
+			}
+			for _, f := range zr.File {
+				if want := tt.opts.Comments[strings.TrimSuffix(f.Name, "/")]; f.Comment != want {
+					t.Errorf("CreateZipballBytesWithOptions() %s comment = %q, want %q", f.Name, f.Comment, want)
+				}
+				if f.Name != "release/notes.txt" {
+					continue
+				}
+				if !f.Modified.Equal(mtime) {
+					t.Errorf("CreateZipballBytesWithOptions() %s modified = %v, want %v", f.Name, f.Modified, mtime)
+				}
+				fields := zipExtraFields(f.Extra)
+				ts := fields[zipExtTimeExtraID]
+				if len(ts) != 1 {
+					t.Fatalf("CreateZipballBytesWithOptions() %d extended timestamps, want 1", len(ts))
+				}
+				if got := len(ts[0]) == 9 && ts[0][0] == 3 && binary.LittleEndian.Uint32(ts[0][5:]) == uint32(atime.Unix()); got != tt.wantAtime {
+					t.Errorf("CreateZipballBytesWithOptions() extended timestamp = %x, want access time %v", ts[0], tt.wantAtime)
+				}
+				owner := fields[zipUnixOwnerExtraID]
+				if (len(owner) == 1) != tt.wantOwner {
+					t.Fatalf("CreateZipballBytesWithOptions() unix extra fields = %x, want %v", owner, tt.wantOwner)
+				}
+				if tt.wantOwner {
+					uid := binary.LittleEndian.Uint32(owner[0][2:])
+					gid := binary.LittleEndian.Uint32(owner[0][7:])
+					if owner[0][0] != 1 || int(uid) != tt.wantUID || int(gid) != tt.wantGID {
+						t.Errorf("CreateZipballBytesWithOptions() unix extra field = %x, want %d:%d", owner[0], tt.wantUID, tt.wantGID)
+					}
+				}
+			}
+		})
+	}
+}
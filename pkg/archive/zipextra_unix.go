@@ -0,0 +1,30 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package archive
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// unixStat represents the file ownership and access time.
+type unixStat struct {
+	uid   int
+	gid   int
+	atime time.Time
+}
+
+// lstatUnix returns the ownership and access time of a file without following symbolic links.
+func lstatUnix(file string) (*unixStat, error) {
+	var st unix.Stat_t
+	if err := unix.Lstat(file, &st); err != nil {
+		return nil, err
+	}
+	return &unixStat{
+		uid:   int(st.Uid),
+		gid:   int(st.Gid),
+		atime: time.Unix(st.Atim.Unix()),
+	}, nil
+}
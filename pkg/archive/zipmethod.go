@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// zipSampleSize is the size of the first file block deflated to estimate the compression gain.
+const zipSampleSize = 64 << 10
+
+// Method represents a rule choosing the Zip compression method of the regular files matching a glob pattern.
+type Method struct {
+	// Pattern is a glob pattern matched like `Override.Pattern` (e.g. `*.png` or `assets/`).
+	// Patterns without a slash ignore case so `*.jpg` matches `IMG_0001.JPG`.
+	Pattern string
+	// Method is either `zip.Store` or `zip.Deflate`.
+	Method uint16
+}
+
+// Methods is a list of compression method rules where the last matching rule wins.
+type Methods []Method
+
+// StoreCompressed stores already compressed file types (images, audio, video, fonts, archives and packages).
+var StoreCompressed = Methods{
+	{Pattern: "*.png", Method: zip.Store},
+	{Pattern: "*.jpg", Method: zip.Store},
+	{Pattern: "*.jpeg", Method: zip.Store},
+	{Pattern: "*.gif", Method: zip.Store},
+	{Pattern: "*.webp", Method: zip.Store},
+	{Pattern: "*.avif", Method: zip.Store},
+	{Pattern: "*.mp3", Method: zip.Store},
+	{Pattern: "*.ogg", Method: zip.Store},
+	{Pattern: "*.mp4", Method: zip.Store},
+	{Pattern: "*.webm", Method: zip.Store},
+	{Pattern: "*.woff", Method: zip.Store},
+	{Pattern: "*.woff2", Method: zip.Store},
+	{Pattern: "*.gz", Method: zip.Store},
+	{Pattern: "*.tgz", Method: zip.Store},
+	{Pattern: "*.bz2", Method: zip.Store},
+	{Pattern: "*.xz", Method: zip.Store},
+	{Pattern: "*.zst", Method: zip.Store},
+	{Pattern: "*.zip", Method: zip.Store},
+	{Pattern: "*.7z", Method: zip.Store},
+	{Pattern: "*.jar", Method: zip.Store},
+	{Pattern: "*.apk", Method: zip.Store},
+}
+
+// validate checks that every rule pattern is well-formed and its method is supported.
+func (m Methods) validate() error {
+	for _, r := range m {
+		if err := validatePattern("method", r.Pattern); err != nil {
+			return err
+		}
+		if r.Method != zip.Store && r.Method != zip.Deflate {
+			return fmt.Errorf("archive/zip: unsupported compression method %d for pattern %q", r.Method, r.Pattern)
+		}
+	}
+	return nil
+}
+
+// resolve returns the method of the last rule matching an entry name.
+func (m Methods) resolve(name string) (uint16, bool) {
+	var method uint16
+	found := false
+	for _, r := range m {
+		pattern, base := r.Pattern, name
+		if !strings.Contains(pattern, "/") {
+			pattern, base = strings.ToLower(pattern), strings.ToLower(path.Base(name))
+		}
+		if matchPattern(pattern, base) {
+			method, found = r.Method, true
+		}
+	}
+	return method, found
+}
+
+// chooseMethod sets the compression method of a regular file header according to the method rules
+// or, for files not matching any rule, to the deflate gain of its first block.
+func (o *ZipOptions) chooseMethod(h *zip.FileHeader, file string) error {
+	if !h.Mode().IsRegular() {
+		return nil
+	}
+	if method, ok := o.Methods.resolve(h.Name); ok {
+		h.Method = method
+		return nil
+	}
+	if o.MinDeflateGain <= 0 || h.UncompressedSize64 == 0 {
+		return nil
+	}
+	gain, err := deflateGain(file)
+	if err != nil {
+		return err
+	}
+	if gain < o.MinDeflateGain {
+		h.Method = zip.Store
+	}
+	return nil
+}
+
+// deflateGain returns the space saving ratio of deflating the first block of a file at the fastest level.
+func deflateGain(file string) (float64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sample := make([]byte, zipSampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	cw := &countingWriter{}
+	fw, err := flate.NewWriter(cw, flate.BestSpeed)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fw.Write(sample[:n]); err != nil {
+		return 0, err
+	}
+	if err := fw.Close(); err != nil {
+		return 0, err
+	}
+	return 1 - float64(cw.n)/float64(n), nil
+}
+
+// countingWriter discards the written bytes counting them.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCreateZipballBytesMethods(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	src := filepath.Join(tmpDirPath, "site")
+	if err := os.MkdirAll(filepath.Join(src, "assets"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	random := make([]byte, 128<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("<p>compactor</p>\n"), 8192)
+	files := map[string][]byte{
+		"index.html":        text,
+		"assets/logo.png":   random,
+		"assets/IMG_01.JPG": random,
+		"assets/data.bin":   random,
+		"assets/table.bin":  text,
+		"assets/empty.bin":  nil,
+		"assets/styles.css": text,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), data, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opts    ZipOptions
+		want    map[string]uint16
+		wantErr bool
+	}{
+		{
+			name: "deflate everything by default",
+			want: map[string]uint16{
+				"site/index.html": zip.Deflate, "site/assets/logo.png": zip.Deflate, "site/assets/data.bin": zip.Deflate,
+				"site/assets/table.bin": zip.Deflate, "site/assets/empty.bin": zip.Deflate, "site/assets/styles.css": zip.Deflate,
+				"site/assets/IMG_01.JPG": zip.Deflate,
+			},
+		},
+		{
+			name: "store compressed types",
+			opts: ZipOptions{Methods: StoreCompressed},
+			want: map[string]uint16{
+				"site/index.html": zip.Deflate, "site/assets/logo.png": zip.Store, "site/assets/data.bin": zip.Deflate,
+				"site/assets/table.bin": zip.Deflate, "site/assets/empty.bin": zip.Deflate, "site/assets/styles.css": zip.Deflate,
+				"site/assets/IMG_01.JPG": zip.Store,
+			},
+		},
+		{
+			name: "last matching rule wins",
+			opts: ZipOptions{Methods: Methods{{Pattern: "site/assets/", Method: zip.Store}, {Pattern: "*.css", Method: zip.Deflate}}},
+			want: map[string]uint16{
+				"site/index.html": zip.Deflate, "site/assets/logo.png": zip.Store, "site/assets/data.bin": zip.Store,
+				"site/assets/table.bin": zip.Store, "site/assets/empty.bin": zip.Store, "site/assets/styles.css": zip.Deflate,
+				"site/assets/IMG_01.JPG": zip.Store,
+			},
+		},
+		{
+			name: "adaptive sampling",
+			opts: ZipOptions{Methods: Methods{{Pattern: "*.png", Method: zip.Deflate}}, MinDeflateGain: 0.05},
+			want: map[string]uint16{
+				"site/index.html": zip.Deflate, "site/assets/logo.png": zip.Deflate, "site/assets/data.bin": zip.Store,
+				"site/assets/table.bin": zip.Deflate, "site/assets/empty.bin": zip.Deflate, "site/assets/styles.css": zip.Deflate,
+				"site/assets/IMG_01.JPG": zip.Store,
+			},
+		},
+		{
+			name:    "unsupported method",
+			opts:    ZipOptions{Methods: Methods{{Pattern: "*.bin", Method: 12}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			opts:    ZipOptions{Methods: Methods{{Pattern: "[", Method: zip.Store}}},
+			wantErr: true,
+		},
+		{
+			name:    "minimum gain out of range",
+			opts:    ZipOptions{MinDeflateGain: 2},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outBuf := &bytes.Buffer{}
+			err := CreateZipballBytesWithOptions(tmpDirPath, "site", outBuf, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateZipballBytesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			data := outBuf.Bytes()
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			got := map[string]uint16{}
+			for _, f := range zr.File {
+				if f.Mode().IsRegular() {
+					got[f.Name] = f.Method
+				}
+				// Stored entries are still extracted as is
+				if err := readZipFile(f, files); err != nil {
+					t.Errorf("CreateZipballBytesWithOptions() %s: %v", f.Name, err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateZipballBytesWithOptions() methods = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// readZipFile compares the content of a regular file entry to the original one.
+func readZipFile(f *zip.File, files map[string][]byte) error {
+	if !f.Mode().IsRegular() {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if want := files[f.Name[len("site/"):]]; !bytes.Equal(data, want) {
+		return fmt.Errorf("content mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// zipUnicodePathExtraID is the Info-ZIP Unicode Path extra field id holding the UTF-8 name of a legacy encoded one.
+const zipUnicodePathExtraID = 0x7075
+
+// cp437 maps the IBM Code Page 437 bytes from 0x80 to Unicode. Lower bytes are ASCII.
+const cp437 = "ÇüéâäàåçêëèïîìÄÅ" +
+	"ÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧" +
+	"╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩" +
+	"≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+var (
+	cp437Decode = []rune(cp437)
+	cp437Encode = func() map[rune]byte {
+		m := map[rune]byte{}
+		for i, r := range []rune(cp437) {
+			m[r] = byte(0x80 + i)
+		}
+		return m
+	}()
+)
+
+// NameDecoder decodes a legacy encoded Zip entry name (e.g. Shift-JIS or GBK) to UTF-8.
+// It returns an error for byte sequences invalid in its encoding.
+// Other decoders from `golang.org/x/text/encoding` can be used like `korean.EUCKR.NewDecoder().String`.
+type NameDecoder func(name string) (string, error)
+
+// detectNameDecoders detect the encoding of names when no decoders are given.
+// Shift-JIS comes first since GBK decodes most Shift-JIS names to unrelated ideographs
+// whereas GBK names decoded as Shift-JIS are made of halfwidth katakana, which are rejected.
+// Both only accept Japanese or Chinese characters so names in IBM Code Page 437 are left to it, mostly.
+var detectNameDecoders = []NameDecoder{detectShiftJIS, detectGBK}
+
+// DecodeShiftJIS decodes a Shift-JIS name, the encoding used by Japanese Windows.
+func DecodeShiftJIS(name string) (string, error) {
+	return decodeName(japanese.ShiftJIS, "Shift-JIS", name)
+}
+
+// DecodeGBK decodes a GBK name, the encoding used by Simplified Chinese Windows.
+func DecodeGBK(name string) (string, error) {
+	return decodeName(simplifiedchinese.GBK, "GBK", name)
+}
+
+// decodeName decodes a name failing on invalid byte sequences, which the x/text decoders replace.
+func decodeName(enc encoding.Encoding, charset string, name string) (string, error) {
+	s, err := enc.NewDecoder().String(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(s, utf8.RuneError) {
+		return "", fmt.Errorf("invalid %s name %q", charset, name)
+	}
+	return s, nil
+}
+
+// detectShiftJIS decodes a Shift-JIS name only holding ASCII, kana, kanji and Japanese punctuation.
+func detectShiftJIS(name string) (string, error) {
+	s, err := DecodeShiftJIS(name)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range s {
+		// The CJK symbols, punctuation, hiragana and fullwidth katakana blocks
+		if r < utf8.RuneSelf || r >= 0x3000 && r <= 0x30ff || unicode.Is(unicode.Han, r) {
+			continue
+		}
+		return "", fmt.Errorf("unlikely Shift-JIS name %q", name)
+	}
+	return s, nil
+}
+
+// detectGBK decodes a GBK name only holding ASCII and GB2312 characters (both bytes from 0xA1 to 0xFE).
+func detectGBK(name string) (string, error) {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x80 {
+			continue
+		}
+		if i+1 >= len(name) || name[i] < 0xa1 || name[i] == 0xff || name[i+1] < 0xa1 || name[i+1] == 0xff {
+			return "", fmt.Errorf("unlikely GBK name %q", name)
+		}
+		i++
+	}
+	return DecodeGBK(name)
+}
+
+// DecodeCP437 decodes an IBM Code Page 437 name, the Zip default encoding of names without the UTF-8 flag.
+func DecodeCP437(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x80 {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune(cp437Decode[c-0x80])
+		}
+	}
+	return b.String(), nil
+}
+
+// encodeCP437 encodes a name in IBM Code Page 437 reporting whether it's representable.
+func encodeCP437(name string) (string, bool) {
+	b := make([]byte, 0, len(name))
+	for _, r := range name {
+		switch c, ok := cp437Encode[r]; {
+		case r < 0x80:
+			b = append(b, byte(r))
+		case ok:
+			b = append(b, c)
+		default:
+			return "", false
+		}
+	}
+	return string(b), true
+}
+
+// isASCII reports whether a string only holds ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// applyZipName encodes the entry name and comment in IBM Code Page 437 (without the UTF-8 flag)
+// for old unzip tools when both are representable. Other non-ASCII names keep the UTF-8 flag set by the Zip writer.
+func (o *ZipOptions) applyZipName(h *zip.FileHeader) {
+	if !o.CP437Names || (isASCII(h.Name) && isASCII(h.Comment)) {
+		return
+	}
+	name, ok := encodeCP437(h.Name)
+	if !ok {
+		return
+	}
+	comment, ok := encodeCP437(h.Comment)
+	if !ok {
+		return
+	}
+	h.Name, h.Comment = name, comment
+	h.NonUTF8 = true
+}
+
+// decodeZipName returns the UTF-8 name of a Zip entry.
+// Names without the UTF-8 flag are taken from an Info-ZIP Unicode Path extra field matching them,
+// kept when they are valid UTF-8 (many writers don't set the flag) or decoded by the first decoder accepting them
+// (Shift-JIS or GBK detection when nil) and finally as IBM Code Page 437.
+func decodeZipName(h *zip.FileHeader, decoders []NameDecoder) string {
+	if !h.NonUTF8 || isASCII(h.Name) {
+		return h.Name
+	}
+	if decoders == nil {
+		decoders = detectNameDecoders
+	}
+	if name, ok := zipUnicodePath(h); ok {
+		return name
+	}
+	if utf8.ValidString(h.Name) {
+		return h.Name
+	}
+	for _, decode := range decoders {
+		name, err := decode(h.Name)
+		if err == nil && !strings.ContainsRune(name, utf8.RuneError) {
+			return name
+		}
+	}
+	name, _ := DecodeCP437(h.Name)
+	return name
+}
+
+// zipUnicodePath returns the UTF-8 name of an Info-ZIP Unicode Path extra field
+// when its CRC-32 matches the legacy encoded name.
+func zipUnicodePath(h *zip.FileHeader) (string, bool) {
+	extra := h.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		data := extra[4 : 4+size]
+		extra = extra[4+size:]
+		// version 1, name CRC-32 and UTF-8 name
+		if id != zipUnicodePathExtraID || len(data) < 5 || data[0] != 1 {
+			continue
+		}
+		if binary.LittleEndian.Uint32(data[1:]) != crc32.ChecksumIEEE([]byte(h.Name)) || !utf8.Valid(data[5:]) {
+			continue
+		}
+		return string(data[5:]), true
+	}
+	return "", false
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipballNames(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	src := filepath.Join(tmpDirPath, "docs")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, name := range []string{"café.txt", "日本.txt", "plain.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      ZipOptions
+		wantNames map[string]string
+		wantUTF8  map[string]bool
+	}{
+		{
+			name:      "utf-8 names",
+			wantNames: map[string]string{"docs/café.txt": "docs/café.txt", "docs/日本.txt": "docs/日本.txt", "docs/plain.txt": "docs/plain.txt"},
+			wantUTF8:  map[string]bool{"docs/café.txt": true, "docs/日本.txt": true},
+		},
+		{
+			name:      "cp437 names",
+			opts:      ZipOptions{CP437Names: true, Comments: map[string]string{"docs/café.txt": "menú"}},
+			wantNames: map[string]string{"docs/café.txt": "docs/caf\x82.txt", "docs/日本.txt": "docs/日本.txt", "docs/plain.txt": "docs/plain.txt"},
+			wantUTF8:  map[string]bool{"docs/日本.txt": true},
+		},
+		{
+			name:      "cp437 names with a non representable comment",
+			opts:      ZipOptions{CP437Names: true, Comments: map[string]string{"docs/café.txt": "メニュー"}},
+			wantNames: map[string]string{"docs/café.txt": "docs/café.txt", "docs/日本.txt": "docs/日本.txt", "docs/plain.txt": "docs/plain.txt"},
+			wantUTF8:  map[string]bool{"docs/café.txt": true, "docs/日本.txt": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outBuf := &bytes.Buffer{}
+			if err := CreateZipballBytesWithOptions(tmpDirPath, "docs", outBuf, tt.opts); err != nil {
+				t.Fatalf("CreateZipballBytesWithOptions() error = %v", err)
+			}
+			data := outBuf.Bytes()
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			raw := map[string]bool{}
+			for _, f := range zr.File {
+				raw[f.Name] = f.Flags&0x800 != 0
+			}
+			r, err := NewZipballReader(bytes.NewReader(data), int64(len(data)), Limits{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			for {
+				e, err := r.Next()
+				if err != nil {
+					break
+				}
+				if !e.Mode.IsRegular() {
+					continue
+				}
+				want, ok := tt.wantNames[e.Name]
+				if !ok {
+					t.Errorf("Reader.Next() name = %q, want one of %v", e.Name, tt.wantNames)
+					continue
+				}
+				if e.Zip.Name != want {
+					t.Errorf("CreateZipballBytesWithOptions() %s raw name = %q, want %q", e.Name, e.Zip.Name, want)
+				}
+				if raw[e.Zip.Name] != tt.wantUTF8[e.Name] {
+					t.Errorf("CreateZipballBytesWithOptions() %s UTF-8 flag = %v, want %v", e.Name, raw[e.Zip.Name], tt.wantUTF8[e.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestZipballReaderNameDecoding(t *testing.T) {
+	unicodePath := func(name string, utf8Name string) []byte {
+		b := make([]byte, 9+len(utf8Name))
+		binary.LittleEndian.PutUint16(b, zipUnicodePathExtraID)
+		binary.LittleEndian.PutUint16(b[2:], uint16(5+len(utf8Name)))
+		b[4] = 1
+		binary.LittleEndian.PutUint32(b[5:], crc32.ChecksumIEEE([]byte(name)))
+		copy(b[9:], utf8Name)
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		raw      string
+		extra    []byte
+		decoders []NameDecoder
+		want     string
+	}{
+		{name: "ascii", raw: "readme.txt", want: "readme.txt"},
+		{name: "cp437 by default", raw: "caf\x82.txt", want: "café.txt"},
+		{name: "cp437 box drawing", raw: "\xc9\xcd\xbb.txt", want: "╔═╗.txt"},
+		{name: "utf-8 without flag", raw: "café.txt", want: "café.txt"},
+		{name: "shift-jis", raw: "\x93\xfa\x96\x7b\x8c\xea.txt", decoders: []NameDecoder{DecodeShiftJIS}, want: "日本語.txt"},
+		{name: "gbk", raw: "\xd6\xd0\xce\xc4.txt", decoders: []NameDecoder{DecodeGBK}, want: "中文.txt"},
+		{name: "decoders tried in order", raw: "\xd6\xd0\xce\xc4.txt", decoders: []NameDecoder{DecodeShiftJIS, DecodeGBK}, want: "ﾖﾐﾎﾄ.txt"},
+		{name: "no decoder accepting it", raw: "\xce\xc4\xbc\xfe.txt", decoders: []NameDecoder{DecodeShiftJIS}, want: "╬─╝■.txt"},
+		{name: "no decoders", raw: "\xd6\xd0\xce\xc4.txt", decoders: []NameDecoder{}, want: "╓╨╬─.txt"},
+		{name: "shift-jis detected", raw: "\x93\xfa\x96\x7b\x8c\xea.txt", want: "日本語.txt"},
+		{name: "shift-jis katakana detected", raw: "\x83\x74\x83\x40\x83\x43\x83\x8b.txt", want: "ファイル.txt"},
+		{name: "shift-jis backslash trail byte detected", raw: "\x95\x5c.txt", want: "表.txt"},
+		{name: "gbk detected", raw: "\xd6\xd0\xce\xc4.txt", want: "中文.txt"},
+		{name: "gbk directory detected", raw: "\xce\xc4\xbc\xfe/\xcb\xb5\xc3\xf7.txt", want: "文件/说明.txt"},
+		{name: "unicode path extra field", raw: "\x93\xfa.txt", extra: unicodePath("\x93\xfa.txt", "日.txt"), want: "日.txt"},
+		{name: "stale unicode path extra field", raw: "caf\x82.txt", extra: unicodePath("cafe.txt", "cafe.txt"), want: "café.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outBuf := &bytes.Buffer{}
+			zw := zip.NewWriter(outBuf)
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: tt.raw, Extra: tt.extra, NonUTF8: true, Method: zip.Store})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if _, err := w.Write([]byte("data")); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("%v", err)
+			}
+			data := outBuf.Bytes()
+			r, err := NewZipballReaderWithOptions(bytes.NewReader(data), int64(len(data)), Limits{}, ZipReaderOptions{NameDecoders: tt.decoders})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			e, err := r.Next()
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if e.Name != tt.want {
+				t.Errorf("Reader.Next() name = %q, want %q", e.Name, tt.want)
+			}
+		})
+	}
+}
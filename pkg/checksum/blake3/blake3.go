@@ -0,0 +1,372 @@
+// Package blake3 implements the BLAKE3 cryptographic hash function including its keyed and key derivation modes.
+// Large inputs are split into 1 KiB chunks which are hashed in parallel across CPU cores using the BLAKE3 tree mode.
+package blake3
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+const (
+	// Size is the default size of a BLAKE3 checksum in bytes.
+	Size = 32
+	// KeySize is the size of a BLAKE3 key in bytes.
+	KeySize = 32
+	// BlockSize is the block size of BLAKE3 in bytes.
+	BlockSize = 64
+
+	chunkLen = 1024
+
+	flagChunkStart        = 1 << 0
+	flagChunkEnd          = 1 << 1
+	flagParent            = 1 << 2
+	flagRoot              = 1 << 3
+	flagKeyedHash         = 1 << 4
+	flagDeriveKeyContext  = 1 << 5
+	flagDeriveKeyMaterial = 1 << 6
+
+	// minChunksPerWorker is the minimum amount of chunks hashed by each parallel worker.
+	minChunksPerWorker = 16
+	// readBlockSize is the amount of bytes read at once per CPU core by `ReadFrom`.
+	readBlockSize = 64 * chunkLen
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] = s[a] + s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] = s[a] + s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+// compress is the BLAKE3 compression function.
+func compress(cv *[8]uint32, m *[16]uint32, counter uint64, blockLen uint32, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	w := *m
+	for r := 0; r < 7; r++ {
+		// Mix the columns
+		g(&s, 0, 4, 8, 12, w[0], w[1])
+		g(&s, 1, 5, 9, 13, w[2], w[3])
+		g(&s, 2, 6, 10, 14, w[4], w[5])
+		g(&s, 3, 7, 11, 15, w[6], w[7])
+		// Mix the diagonals
+		g(&s, 0, 5, 10, 15, w[8], w[9])
+		g(&s, 1, 6, 11, 12, w[10], w[11])
+		g(&s, 2, 7, 8, 13, w[12], w[13])
+		g(&s, 3, 4, 9, 14, w[14], w[15])
+		if r < 6 {
+			var p [16]uint32
+			for i, j := range msgPermutation {
+				p[i] = w[j]
+			}
+			w = p
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func first8(s [16]uint32) (cv [8]uint32) {
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func wordsFromBytes(b []byte, words []uint32) {
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+}
+
+// output represents the state just prior to the last compression of a chunk or parent node.
+type output struct {
+	inputCV  [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *output) chainingValue() [8]uint32 {
+	return first8(compress(&o.inputCV, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func (o *output) rootBytes(out []byte) {
+	var buf [BlockSize]byte
+	for counter := uint64(0); len(out) > 0; counter++ {
+		words := compress(&o.inputCV, &o.block, counter, o.blockLen, o.flags|flagRoot)
+		for i, w := range words {
+			binary.LittleEndian.PutUint32(buf[4*i:], w)
+		}
+		out = out[copy(out, buf[:]):]
+	}
+}
+
+func parentOutput(left, right [8]uint32, key *[8]uint32, flags uint32) output {
+	o := output{inputCV: *key, blockLen: BlockSize, flags: flags | flagParent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+// chunkState represents the incremental state of a single chunk.
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+	flags            uint32
+}
+
+func newChunkState(key *[8]uint32, counter uint64, flags uint32) chunkState {
+	return chunkState{cv: *key, counter: counter, flags: flags}
+}
+
+func (c *chunkState) len() int {
+	return BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		// A full block is compressed only when more input arrives
+		// since the last block of a chunk needs the chunk end flag.
+		if c.blockLen == BlockSize {
+			var words [16]uint32
+			wordsFromBytes(c.block[:], words[:])
+			c.cv = first8(compress(&c.cv, &words, c.counter, BlockSize, c.flags|c.startFlag()))
+			c.blocksCompressed++
+			c.block = [BlockSize]byte{}
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	o := output{
+		inputCV:  c.cv,
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.flags | c.startFlag() | flagChunkEnd,
+	}
+	wordsFromBytes(c.block[:], o.block[:])
+	return o
+}
+
+// chunkChainingValue computes the chaining value of a whole non-root chunk.
+func chunkChainingValue(key *[8]uint32, chunk []byte, counter uint64, flags uint32) [8]uint32 {
+	c := newChunkState(key, counter, flags)
+	c.update(chunk)
+	o := c.output()
+	return o.chainingValue()
+}
+
+// Hasher is an incremental BLAKE3 hasher which implements the `hash.Hash` interface.
+type Hasher struct {
+	key        [8]uint32
+	flags      uint32
+	chunk      chunkState
+	cvStack    [54][8]uint32
+	cvStackLen int
+}
+
+var _ hash.Hash = (*Hasher)(nil)
+
+func newHasher(key [8]uint32, flags uint32) *Hasher {
+	return &Hasher{key: key, flags: flags, chunk: newChunkState(&key, 0, flags)}
+}
+
+// New returns a new BLAKE3 hasher computing a 32 bytes checksum.
+func New() *Hasher {
+	return newHasher(iv, 0)
+}
+
+// NewKeyed returns a new BLAKE3 hasher in keyed mode (a MAC) using a 32 bytes key.
+func NewKeyed(key []byte) (*Hasher, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("blake3: key size must be 32 bytes")
+	}
+	var k [8]uint32
+	wordsFromBytes(key, k[:])
+	return newHasher(k, flagKeyedHash), nil
+}
+
+// NewDeriveKey returns a new BLAKE3 hasher in key derivation mode for a hardcoded and globally unique context string.
+// The key material should be written into the hasher and the derived key read using `Sum` or `XOF`.
+func NewDeriveKey(context string) *Hasher {
+	h := newHasher(iv, flagDeriveKeyContext)
+	io.WriteString(h, context)
+	var ctxKey [KeySize]byte
+	h.XOF(ctxKey[:])
+	var k [8]uint32
+	wordsFromBytes(ctxKey[:], k[:])
+	return newHasher(k, flagDeriveKeyMaterial)
+}
+
+// Sum256 returns the BLAKE3 checksum of the data.
+func Sum256(data []byte) (sum [Size]byte) {
+	h := New()
+	h.Write(data)
+	h.XOF(sum[:])
+	return sum
+}
+
+// Size returns the number of bytes `Sum` will return.
+func (h *Hasher) Size() int { return Size }
+
+// BlockSize returns the hash underlying block size.
+func (h *Hasher) BlockSize() int { return BlockSize }
+
+// Reset resets the hasher to its initial state.
+func (h *Hasher) Reset() {
+	h.chunk = newChunkState(&h.key, 0, h.flags)
+	h.cvStackLen = 0
+}
+
+// addChunkChainingValue pushes a new chunk chaining value merging completed subtrees.
+// The number of trailing zero bits of the total chunks count is the number of subtrees to merge.
+func (h *Hasher) addChunkChainingValue(cv [8]uint32, totalChunks uint64) {
+	for totalChunks&1 == 0 {
+		h.cvStackLen--
+		o := parentOutput(h.cvStack[h.cvStackLen], cv, &h.key, h.flags)
+		cv = o.chainingValue()
+		totalChunks >>= 1
+	}
+	h.cvStack[h.cvStackLen] = cv
+	h.cvStackLen++
+}
+
+// Write adds more data to the running hash. It never returns an error.
+func (h *Hasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.chunk.len() == chunkLen {
+			cv := h.chunk.output()
+			total := h.chunk.counter + 1
+			h.addChunkChainingValue(cv.chainingValue(), total)
+			h.chunk = newChunkState(&h.key, total, h.flags)
+		}
+		// Whole chunks are hashed in parallel keeping at least one byte
+		// for the current chunk since the last chunk may be the root node.
+		if h.chunk.len() == 0 && len(p) > 2*minChunksPerWorker*chunkLen {
+			chunks := (len(p) - 1) / chunkLen
+			h.writeChunks(p[:chunks*chunkLen])
+			p = p[chunks*chunkLen:]
+			continue
+		}
+		take := chunkLen - h.chunk.len()
+		if take > len(p) {
+			take = len(p)
+		}
+		h.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+// writeChunks hashes whole chunks in parallel and adds their chaining values to the tree in order.
+func (h *Hasher) writeChunks(data []byte) {
+	n := len(data) / chunkLen
+	counter := h.chunk.counter
+	cvs := make([][8]uint32, n)
+	workers := runtime.GOMAXPROCS(0)
+	if max := n / minChunksPerWorker; workers > max {
+		workers = max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	per := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += per {
+		end := start + per
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				cvs[i] = chunkChainingValue(&h.key, data[i*chunkLen:(i+1)*chunkLen], counter+uint64(i), h.flags)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	for i, cv := range cvs {
+		h.addChunkChainingValue(cv, counter+uint64(i)+1)
+	}
+	h.chunk = newChunkState(&h.key, counter+uint64(n), h.flags)
+}
+
+// ReadFrom reads data from r until EOF and adds it to the running hash.
+// Data is read in large blocks so that chunks can be hashed in parallel.
+func (h *Hasher) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, readBlockSize*runtime.GOMAXPROCS(0))
+	var total int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		h.Write(buf[:n])
+		total += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// rootOutput computes the root node output without modifying the hasher state.
+func (h *Hasher) rootOutput() output {
+	o := h.chunk.output()
+	for i := h.cvStackLen - 1; i >= 0; i-- {
+		o = parentOutput(h.cvStack[i], o.chainingValue(), &h.key, h.flags)
+	}
+	return o
+}
+
+// Sum appends the current 32 bytes checksum to b and returns the resulting slice.
+// It does not change the underlying hash state.
+func (h *Hasher) Sum(b []byte) []byte {
+	var sum [Size]byte
+	h.XOF(sum[:])
+	return append(b, sum[:]...)
+}
+
+// XOF fills out with an extended output of arbitrary length.
+// The first 32 bytes are equal to the default checksum. It does not change the underlying hash state.
+func (h *Hasher) XOF(out []byte) {
+	o := h.rootOutput()
+	o.rootBytes(out)
+}
@@ -1,78 +1,254 @@
-// Package checksum provides checksum computation for files using md5, sha1, sha256 and sha512 algorithms.
+// Package checksum provides checksum computation for files using md5, sha1, sha2, sha3, blake2, blake3 and crc32 algorithms
+// or any other hash algorithm registered by name.
 package checksum
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
-	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
-// ComputeChecksum computes a `md5`, `sha1`, `sha256` or `sha512` message digest.
+// Checksum represents a message digest computed for a file.
+type Checksum struct {
+	// Algo is the hash algorithm name (e.g. `sha256`).
+	Algo string
+	// File is the file path the digest belongs to.
+	File string
+	// Hash is the hex-encoded message digest.
+	Hash string
+}
+
+// bufferSize is the constant buffer size used for streaming data into hashes.
+const bufferSize = 32 * 1024
+
+// ComputeChecksum computes a message digest using a registered algorithm (e.g. `md5`, `sha1`, `sha256` or `sha512`).
+// Data is streamed into the hash so the reader is never fully loaded in memory.
 func ComputeChecksum(r io.Reader, algo string) (hash string, err error) {
-	data, err := ioutil.ReadAll(r)
+	hashes, err := ComputeChecksums(r, algo)
 	if err != nil {
 		return "", err
 	}
-	algo = strings.ToLower(strings.TrimSpace(algo))
-	switch algo {
-	case "md5":
-		hash = fmt.Sprintf("%x", md5.Sum(data))
-	case "sha1":
-		hash = fmt.Sprintf("%x", sha1.Sum(data))
-	case "sha256":
-		hash = fmt.Sprintf("%x", sha256.Sum256(data))
-	case "sha512":
-		hash = fmt.Sprintf("%x", sha512.Sum512(data))
-	default:
-		return "", fmt.Errorf("hash algorithm `%s` is not supported", algo)
-	}
-	return hash, nil
+	return hashes[0], nil
 }
 
-// CreateChecksumFiles computes `md5`, `sha1`, `sha256` or `sha512` message digest and save it into a file.
+// ComputeChecksums computes several message digests feeding all hashes in a single pass over the reader.
+// It returns the hex-encoded digests in the same order as the provided algorithms.
+func ComputeChecksums(r io.Reader, algos ...string) ([]string, error) {
+	hashes := make([]hash.Hash, len(algos))
+	writers := make([]io.Writer, len(algos))
+	for i, algo := range algos {
+		h, err := NewHash(algo)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = h
+		writers[i] = h
+	}
+	// A single hash is fed directly so it can read larger blocks if it supports it (e.g. `blake3`)
+	w := io.MultiWriter(writers...)
+	if len(writers) == 1 {
+		w = writers[0]
+	}
+	buf := make([]byte, bufferSize)
+	if _, err := io.CopyBuffer(w, r, buf); err != nil {
+		return nil, err
+	}
+	sums := make([]string, len(hashes))
+	for i, h := range hashes {
+		sums[i] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// CreateChecksumFiles computes message digests using registered algorithms (e.g. `md5`, `sha1`, `sha256` or `sha512`) and save them into files.
 // It returns checksum file paths or an error.
 func CreateChecksumFiles(files []string, checksumAlgos []string, checksumDst string, filesBasename bool) ([]string, error) {
-	checksums := make(map[string][]string)
-	for _, algo := range checksumAlgos {
-		for _, f := range files {
-			r, err := os.Open(f)
-			defer r.Close()
-			if err != nil {
-				return nil, fmt.Errorf("failed to read %s file: %w", f, err)
-			}
-			sum, err := ComputeChecksum(r, algo)
-			if err != nil {
-				return nil, err
-			}
-			checksums[algo] = append(checksums[algo], sum, f)
-		}
+	return CreateChecksumFilesWithFormat(files, checksumAlgos, checksumDst, filesBasename, FormatGNU)
+}
+
+// CreateChecksumFilesWithFormat computes message digests using registered algorithms and save them into files using a checksum file format.
+// It returns checksum file paths or an error.
+func CreateChecksumFilesWithFormat(files []string, checksumAlgos []string, checksumDst string, filesBasename bool, format Formatter) ([]string, error) {
+	checksums, err := computeFileChecksums(files, checksumAlgos)
+	if err != nil {
+		return nil, err
 	}
-	var outfiles []string
-	for algo, values := range checksums {
-		filename := strings.Replace(checksumDst, "CHECKSUM", algo, -1)
-		f, err := os.Create(filename)
-		defer f.Close()
+	return WriteChecksumFilesWithFormat(checksums, checksumDst, filesBasename, format)
+}
+
+// MergeChecksumFiles computes message digests using registered algorithms and merge them into existing checksum files.
+// A file already listed for the same algorithm has its checksum replaced so merging is idempotent.
+// Merged entries are sorted by file name and each checksum file is written atomically.
+// It returns checksum file paths or an error.
+func MergeChecksumFiles(files []string, checksumAlgos []string, checksumDst string, filesBasename bool, format Formatter) ([]string, error) {
+	checksums, err := computeFileChecksums(files, checksumAlgos)
+	if err != nil {
+		return nil, err
+	}
+	return MergeChecksums(checksums, checksumDst, filesBasename, format)
+}
+
+// computeFileChecksums computes the message digests of files reading every file only once.
+func computeFileChecksums(files []string, checksumAlgos []string) ([]Checksum, error) {
+	sums := make([][]string, len(files))
+	for i, f := range files {
+		r, err := os.Open(f)
 		if err != nil {
+			return nil, fmt.Errorf("failed to read %s file: %w", f, err)
+		}
+		sums[i], err = ComputeChecksums(r, checksumAlgos...)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var checksums []Checksum
+	for j, algo := range checksumAlgos {
+		for i, f := range files {
+			checksums = append(checksums, Checksum{Algo: algo, File: f, Hash: sums[i][j]})
+		}
+	}
+	return checksums, nil
+}
+
+// WriteChecksumFiles saves already computed message digests into one GNU-style file per algorithm.
+// The `CHECKSUM` placeholder of checksumDst is replaced by the algorithm name (slashes replaced by dashes).
+// It returns checksum file paths or an error.
+func WriteChecksumFiles(checksums []Checksum, checksumDst string, filesBasename bool) ([]string, error) {
+	return WriteChecksumFilesWithFormat(checksums, checksumDst, filesBasename, FormatGNU)
+}
+
+// WriteChecksumFilesWithFormat saves already computed message digests into one file per algorithm using a checksum file format.
+// The `CHECKSUM` placeholder of checksumDst is replaced by the algorithm name (slashes replaced by dashes).
+// Otherwise if checksumDst has no placeholder then all algorithms are saved into the same file.
+// It returns checksum file paths or an error.
+func WriteChecksumFilesWithFormat(checksums []Checksum, checksumDst string, filesBasename bool, format Formatter) ([]string, error) {
+	if format == nil {
+		format = FormatGNU
+	}
+	outfiles, byFile := groupChecksums(checksums, checksumDst, filesBasename)
+	for _, filename := range outfiles {
+		if err := writeChecksumFile(filename, byFile[filename], format); err != nil {
 			return nil, err
 		}
-		for i := 0; i < len(values); i += 2 {
-			hash := values[i]
-			file := values[i+1]
-			if filesBasename {
-				file = filepath.Base(file)
+	}
+	return outfiles, nil
+}
+
+// MergeChecksums merges already computed message digests into existing checksum files.
+// The `CHECKSUM` placeholder of checksumDst is replaced by the algorithm name (slashes replaced by dashes).
+// A file already listed for the same algorithm has its checksum replaced so merging is idempotent.
+// Merged entries are sorted by file name and each checksum file is written atomically.
+// The format must implement the `Parser` interface in order to read existing checksum files.
+// It returns checksum file paths or an error.
+func MergeChecksums(checksums []Checksum, checksumDst string, filesBasename bool, format Formatter) ([]string, error) {
+	if format == nil {
+		format = FormatGNU
+	}
+	parser, ok := format.(Parser)
+	if !ok {
+		return nil, fmt.Errorf("checksum format %T can not be parsed for merging", format)
+	}
+	outfiles, byFile := groupChecksums(checksums, checksumDst, filesBasename)
+	for _, filename := range outfiles {
+		var merged []Checksum
+		f, err := os.Open(filename)
+		switch {
+		case err == nil:
+			// GNU lines don't carry their algorithm so it's taken from the new entries if they share it
+			algo := byFile[filename][0].Algo
+			for _, c := range byFile[filename] {
+				if normalizeAlgo(c.Algo) != normalizeAlgo(algo) {
+					algo = ""
+					break
+				}
 			}
-			if _, err := f.WriteString(fmt.Sprintf("%s  %s\n", hash, file)); err != nil {
-				return nil, err
+			merged, err = parser.Parse(f, algo)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("can't parse checksum file %s: %w", filename, err)
 			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+		merged = mergeChecksums(merged, byFile[filename])
+		if err := writeChecksumFile(filename, merged, format); err != nil {
+			return nil, err
 		}
-		outfiles = append(outfiles, filename)
 	}
 	return outfiles, nil
 }
+
+// groupChecksums groups the checksums by destination file name keeping the first seen order.
+func groupChecksums(checksums []Checksum, checksumDst string, filesBasename bool) ([]string, map[string][]Checksum) {
+	var outfiles []string
+	byFile := make(map[string][]Checksum)
+	for _, c := range checksums {
+		filename := strings.Replace(checksumDst, "CHECKSUM", strings.ReplaceAll(c.Algo, "/", "-"), -1)
+		if _, ok := byFile[filename]; !ok {
+			outfiles = append(outfiles, filename)
+		}
+		if filesBasename {
+			c.File = filepath.Base(c.File)
+		}
+		byFile[filename] = append(byFile[filename], c)
+	}
+	return outfiles, byFile
+}
+
+// mergeChecksums replaces or appends the new checksums by file and algorithm and sorts the result.
+func mergeChecksums(checksums []Checksum, newChecksums []Checksum) []Checksum {
+	index := make(map[[2]string]int, len(checksums))
+	var merged []Checksum
+	for _, c := range append(checksums, newChecksums...) {
+		c.Algo = normalizeAlgo(c.Algo)
+		key := [2]string{c.File, c.Algo}
+		if i, ok := index[key]; ok {
+			merged[i] = c
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, c)
+	}
+	sortChecksums(merged)
+	return merged
+}
+
+// sortChecksums sorts checksums by file name and algorithm.
+func sortChecksums(checksums []Checksum) {
+	sort.SliceStable(checksums, func(i, j int) bool {
+		if checksums[i].File != checksums[j].File {
+			return checksums[i].File < checksums[j].File
+		}
+		return checksums[i].Algo < checksums[j].Algo
+	})
+}
+
+// writeChecksumFile writes a checksum file atomically using a temporary file renamed once fully written.
+func writeChecksumFile(filename string, checksums []Checksum, format Formatter) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = format.Format(f, checksums)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
@@ -73,6 +73,75 @@ func TestComputeChecksum(t *testing.T) {
 	}
 }
 
+func TestComputeChecksums(t *testing.T) {
+	type args struct {
+		r     io.Reader
+		algos []string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantHashes []string
+		wantErr    bool
+	}{
+		{
+			name: "invalid algorithm",
+			args: args{
+				r:     strings.NewReader("abc"),
+				algos: []string{"md5", "sha11"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no algorithms",
+			args: args{
+				r: strings.NewReader("abc"),
+			},
+			wantHashes: []string{},
+		},
+		{
+			name: "several algorithms in one pass",
+			args: args{
+				r:     strings.NewReader("abc"),
+				algos: []string{"md5", "SHA256"},
+			},
+			wantHashes: []string{
+				"900150983cd24fb0d6963f7d28e17f72",
+				"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			},
+		},
+		{
+			name: "input larger than buffer size",
+			args: args{
+				r:     io.LimitReader(zeroReader{}, 10*bufferSize+7),
+				algos: []string{"sha1"},
+			},
+			wantHashes: []string{"67a386b4d72374d5832622e488c57cddfe709e45"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHashes, err := ComputeChecksums(tt.args.r, tt.args.algos...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ComputeChecksums() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotHashes, tt.wantHashes) {
+				t.Errorf("ComputeChecksums() = %v, want %v", gotHashes, tt.wantHashes)
+			}
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func TestCreateChecksumFiles(t *testing.T) {
 	type args struct {
 		files         []string
@@ -116,6 +185,16 @@ func TestCreateChecksumFiles(t *testing.T) {
 			},
 			want: []string{"/tmp/LICENSE.md5-OK.txt", "/tmp/LICENSE.sha1-OK.txt"},
 		},
+		{
+			name: "checksums with registered algorithm names containing slashes",
+			args: args{
+				files:         []string{"../../LICENSE-MIT"},
+				checksumAlgos: []string{"sha512/256", "blake2b-256"},
+				checksumDst:   "/tmp/LICENSE.CHECKSUM-OK.txt",
+				filesBasename: true,
+			},
+			want: []string{"/tmp/LICENSE.sha512-256-OK.txt", "/tmp/LICENSE.blake2b-256-OK.txt"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,165 @@
+package checksum
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formatter writes message digests using a specific checksum file format.
+type Formatter interface {
+	// Format writes the checksums to w.
+	Format(w io.Writer, checksums []Checksum) error
+}
+
+// Parser reads message digests written using a specific checksum file format.
+// Formatters implementing it can be used to merge checksum files.
+type Parser interface {
+	// Parse reads the checksums from r.
+	// The algo param is used for lines which do not carry their algorithm (e.g. GNU lines)
+	// and if empty then it is inferred from the digest length.
+	Parse(r io.Reader, algo string) ([]Checksum, error)
+}
+
+var (
+	// FormatGNU writes GNU coreutils lines (`hash  file`) like `sha256sum` does.
+	FormatGNU Formatter = gnuFormat{}
+	// FormatBSD writes BSD tag-style lines (`SHA256 (file) = hash`) like `shasum --tag` does.
+	FormatBSD Formatter = bsdFormat{}
+	// FormatJSON writes a JSON document keyed by file and algorithm.
+	FormatJSON Formatter = jsonFormat{}
+	// FormatCSV writes CSV records (`file,algorithm,checksum`) preceded by a header record.
+	FormatCSV Formatter = csvFormat{}
+)
+
+type gnuFormat struct{}
+
+func (gnuFormat) Format(w io.Writer, checksums []Checksum) error {
+	for _, c := range checksums {
+		// File names with backslashes or newlines are escaped like GNU coreutils does
+		prefix, file := "", c.File
+		if strings.ContainsAny(file, "\\\n\r") {
+			prefix = "\\"
+			file = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(file)
+		}
+		if _, err := fmt.Fprintf(w, "%s%s  %s\n", prefix, c.Hash, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gnuFormat) Parse(r io.Reader, algo string) ([]Checksum, error) {
+	return parseLines(r, algo)
+}
+
+// parseLines reads GNU or BSD checksum lines failing on improperly formatted ones.
+func parseLines(r io.Reader, algo string) ([]Checksum, error) {
+	var checksums []Checksum
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a, sum, file, err := parseChecksumLine(line, algo)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		checksums = append(checksums, Checksum{Algo: a, File: file, Hash: sum})
+	}
+	return checksums, s.Err()
+}
+
+// bsdTags maps algorithm names to the BSD tags used by common tools when they are not just upper-cased.
+var bsdTags = map[string]string{
+	"blake2b-512": "BLAKE2b",
+	"blake2s-256": "BLAKE2s",
+}
+
+type bsdFormat struct{}
+
+func (bsdFormat) Format(w io.Writer, checksums []Checksum) error {
+	for _, c := range checksums {
+		algo := normalizeAlgo(c.Algo)
+		tag, ok := bsdTags[algo]
+		if !ok {
+			tag = strings.ToUpper(algo)
+		}
+		if _, err := fmt.Fprintf(w, "%s (%s) = %s\n", tag, c.File, c.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bsdFormat) Parse(r io.Reader, algo string) ([]Checksum, error) {
+	return parseLines(r, algo)
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Format(w io.Writer, checksums []Checksum) error {
+	doc := make(map[string]map[string]string)
+	for _, c := range checksums {
+		if doc[c.File] == nil {
+			doc[c.File] = make(map[string]string)
+		}
+		doc[c.File][normalizeAlgo(c.Algo)] = c.Hash
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (jsonFormat) Parse(r io.Reader, algo string) ([]Checksum, error) {
+	var doc map[string]map[string]string
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var checksums []Checksum
+	for file, sums := range doc {
+		for a, sum := range sums {
+			checksums = append(checksums, Checksum{Algo: a, File: file, Hash: sum})
+		}
+	}
+	sortChecksums(checksums)
+	return checksums, nil
+}
+
+type csvFormat struct{}
+
+func (csvFormat) Format(w io.Writer, checksums []Checksum) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"file", "algorithm", "checksum"}); err != nil {
+		return err
+	}
+	for _, c := range checksums {
+		if err := cw.Write([]string{c.File, normalizeAlgo(c.Algo), c.Hash}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (csvFormat) Parse(r io.Reader, algo string) ([]Checksum, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var checksums []Checksum
+	for i, rec := range records {
+		if len(rec) != 3 {
+			return nil, fmt.Errorf("record %d: expected 3 fields but got %d", i+1, len(rec))
+		}
+		if i == 0 && rec[0] == "file" {
+			continue
+		}
+		checksums = append(checksums, Checksum{Algo: rec[1], File: rec[0], Hash: rec[2]})
+	}
+	return checksums, nil
+}
@@ -0,0 +1,247 @@
+package checksum
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatter(t *testing.T) {
+	checksums := []Checksum{
+		{Algo: "sha256", File: "app.tar.gz", Hash: "aa11"},
+		{Algo: "blake2b-512", File: "app.zip", Hash: "bb22"},
+		{Algo: "SHA256", File: "dir\\app,1.zip", Hash: "cc33"},
+	}
+	tests := []struct {
+		name   string
+		format Formatter
+		want   string
+	}{
+		{
+			name:   "gnu format",
+			format: FormatGNU,
+			want:   "aa11  app.tar.gz\nbb22  app.zip\n\\cc33  dir\\\\app,1.zip\n",
+		},
+		{
+			name:   "bsd format",
+			format: FormatBSD,
+			want:   "SHA256 (app.tar.gz) = aa11\nBLAKE2b (app.zip) = bb22\nSHA256 (dir\\app,1.zip) = cc33\n",
+		},
+		{
+			name:   "json format",
+			format: FormatJSON,
+			want: `{
+  "app.tar.gz": {
+    "sha256": "aa11"
+  },
+  "app.zip": {
+    "blake2b-512": "bb22"
+  },
+  "dir\\app,1.zip": {
+    "sha256": "cc33"
+  }
+}
+`,
+		},
+		{
+			name:   "csv format",
+			format: FormatCSV,
+			want:   "file,algorithm,checksum\napp.tar.gz,sha256,aa11\napp.zip,blake2b-512,bb22\n\"dir\\app,1.zip\",sha256,cc33\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.format.Format(&buf, checksums); err != nil {
+				t.Errorf("Format() error = %v", err)
+				return
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateChecksumFilesWithFormat(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	file := filepath.Join(tmpDirPath, "file.txt")
+	if err := ioutil.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// All algorithms are saved into the same file when there is no placeholder
+	dst := filepath.Join(tmpDirPath, "SUMS.txt")
+	got, err := CreateChecksumFilesWithFormat([]string{file}, []string{"md5", "sha256"}, dst, true, FormatBSD)
+	if err != nil {
+		t.Fatalf("CreateChecksumFilesWithFormat() error = %v", err)
+	}
+	if want := []string{dst}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateChecksumFilesWithFormat() = %v, want %v", got, want)
+	}
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	want := "MD5 (file.txt) = 900150983cd24fb0d6963f7d28e17f72\n" +
+		"SHA256 (file.txt) = ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad\n"
+	if string(data) != want {
+		t.Errorf("CreateChecksumFilesWithFormat() content = %q, want %q", data, want)
+	}
+	results, err := VerifyChecksumFile(dst, VerifyOptions{})
+	if err != nil || len(results) != 2 {
+		t.Errorf("VerifyChecksumFile() = %v, %v", results, err)
+	}
+}
+
+type lineFormat struct{}
+
+func (lineFormat) Format(w io.Writer, checksums []Checksum) error {
+	return FormatGNU.Format(w, checksums)
+}
+
+func TestMergeChecksumFiles(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	write := func(name, content string) string {
+		file := filepath.Join(tmpDirPath, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return file
+	}
+	linux := write("app-linux.tar.gz", "abc")
+	darwin := write("app-darwin.tar.gz", "efg")
+
+	const (
+		sumAbc = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+		sumEfg = "d4ffe8e9ee0b48eba716706123a7187f32eae3bdcb0e7763e41e533267bd8a53"
+		sumXyz = "3608bca1e44ea6c4d268eb6db02260269892c0b42b86bbf1e77a6fa16c3c9282"
+	)
+	tests := []struct {
+		name   string
+		files  []string
+		update func()
+		want   string
+	}{
+		{
+			name:  "create checksum file",
+			files: []string{linux},
+			want:  sumAbc + "  app-linux.tar.gz\n",
+		},
+		{
+			name:  "append another artifact sorted by file name",
+			files: []string{linux, darwin},
+			want:  sumEfg + "  app-darwin.tar.gz\n" + sumAbc + "  app-linux.tar.gz\n",
+		},
+		{
+			name:  "merge is idempotent",
+			files: []string{darwin},
+			want:  sumEfg + "  app-darwin.tar.gz\n" + sumAbc + "  app-linux.tar.gz\n",
+		},
+		{
+			name:   "replace existing artifact line",
+			files:  []string{linux},
+			update: func() { write("app-linux.tar.gz", "xyz") },
+			want:   sumEfg + "  app-darwin.tar.gz\n" + sumXyz + "  app-linux.tar.gz\n",
+		},
+	}
+	dst := filepath.Join(tmpDirPath, "CHECKSUMSUMS")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.update != nil {
+				tt.update()
+			}
+			got, err := MergeChecksumFiles(tt.files, []string{"SHA256"}, dst, true, FormatGNU)
+			if err != nil {
+				t.Fatalf("MergeChecksumFiles() error = %v", err)
+			}
+			want := filepath.Join(tmpDirPath, "SHA256SUMS")
+			if !reflect.DeepEqual(got, []string{want}) {
+				t.Errorf("MergeChecksumFiles() = %v, want %v", got, want)
+			}
+			data, err := ioutil.ReadFile(want)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("MergeChecksumFiles() content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(tmpDirPath)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("MergeChecksumFiles() left %d files, want %d", len(entries), 3)
+	}
+}
+
+func TestMergeChecksums(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	var (
+		sha256A = strings.Repeat("a", 64)
+		sha256C = strings.Repeat("c", 64)
+		md5B    = strings.Repeat("b", 32)
+		md5D    = strings.Repeat("d", 32)
+	)
+	first := []Checksum{
+		{Algo: "sha256", File: "b.zip", Hash: sha256A},
+		{Algo: "md5", File: "b.zip", Hash: md5B},
+	}
+	second := []Checksum{
+		{Algo: "sha256", File: "a.zip", Hash: sha256C},
+		{Algo: "md5", File: "b.zip", Hash: md5D},
+	}
+	for _, format := range []Formatter{FormatBSD, FormatJSON, FormatCSV} {
+		dst := filepath.Join(tmpDirPath, fmt.Sprintf("SUMS-%T", format))
+		if _, err := MergeChecksums(first, dst, false, format); err != nil {
+			t.Fatalf("MergeChecksums(%T) error = %v", format, err)
+		}
+		if _, err := MergeChecksums(second, dst, false, format); err != nil {
+			t.Fatalf("MergeChecksums(%T) error = %v", format, err)
+		}
+		f, err := os.Open(dst)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		got, err := format.(Parser).Parse(f, "")
+		f.Close()
+		if err != nil {
+			t.Fatalf("Parse(%T) error = %v", format, err)
+		}
+		want := []Checksum{
+			{Algo: "sha256", File: "a.zip", Hash: sha256C},
+			{Algo: "md5", File: "b.zip", Hash: md5D},
+			{Algo: "sha256", File: "b.zip", Hash: sha256A},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MergeChecksums(%T) = %v, want %v", format, got, want)
+		}
+	}
+
+	if _, err := MergeChecksums(first, filepath.Join(tmpDirPath, "SUMS"), false, lineFormat{}); err == nil {
+		t.Errorf("MergeChecksums() error = %v, want non-parser format error", err)
+	}
+}
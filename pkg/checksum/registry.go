@@ -0,0 +1,104 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joseluisq/compactor/pkg/checksum/blake3"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() hash.Hash)
+)
+
+func init() {
+	Register("md5", md5.New)
+	Register("sha1", sha1.New)
+	Register("sha224", sha256.New224)
+	Register("sha256", sha256.New)
+	Register("sha384", sha512.New384)
+	Register("sha512", sha512.New)
+	Register("sha512/224", sha512.New512_224)
+	Register("sha512/256", sha512.New512_256)
+	Register("sha3-224", sha3.New224)
+	Register("sha3-256", sha3.New256)
+	Register("sha3-384", sha3.New384)
+	Register("sha3-512", sha3.New512)
+	Register("blake2b-256", unkeyed(blake2b.New256))
+	Register("blake2b-384", unkeyed(blake2b.New384))
+	Register("blake2b-512", unkeyed(blake2b.New512))
+	Register("blake2s-256", unkeyed(blake2s.New256))
+	Register("blake3", func() hash.Hash { return blake3.New() })
+	Register("crc32", func() hash.Hash { return crc32.NewIEEE() })
+	Register("crc32c", func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) })
+}
+
+// unkeyed adapts a keyed hash constructor to be used without key.
+func unkeyed(newFunc func(key []byte) (hash.Hash, error)) func() hash.Hash {
+	return func() hash.Hash {
+		h, err := newFunc(nil)
+		if err != nil {
+			// A nil key is always accepted by unkeyed constructors
+			panic(err)
+		}
+		return h
+	}
+}
+
+// Register makes a hash algorithm available by the provided name (case-insensitive).
+// It panics if Register is called twice with the same name or if newFunc is nil.
+func Register(name string, newFunc func() hash.Hash) {
+	name = normalizeAlgo(name)
+	if name == "" {
+		panic("checksum: Register algorithm name is empty")
+	}
+	if newFunc == nil {
+		panic("checksum: Register hash function is nil")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("checksum: Register called twice for algorithm " + name)
+	}
+	registry[name] = newFunc
+}
+
+// Algorithms returns a sorted list of the names of the registered hash algorithms.
+func Algorithms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewHash returns a new `hash.Hash` for a registered algorithm name (e.g. `md5`, `sha256` or `blake2b-512`).
+func NewHash(algo string) (hash.Hash, error) {
+	algo = normalizeAlgo(algo)
+	registryMu.RLock()
+	newFunc, ok := registry[algo]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("hash algorithm `%s` is not supported", algo)
+	}
+	return newFunc(), nil
+}
+
+func normalizeAlgo(algo string) string {
+	return strings.ToLower(strings.TrimSpace(algo))
+}
@@ -0,0 +1,87 @@
+package checksum
+
+import (
+	"hash"
+	"hash/adler32"
+	"strings"
+	"testing"
+)
+
+func TestNewHash(t *testing.T) {
+	tests := []struct {
+		algo     string
+		wantHash string
+		wantErr  bool
+	}{
+		{algo: "sha3-255", wantErr: true},
+		{algo: "sha224", wantHash: "23097d223405d8228642a477bda255b32aadbce4bda0b3f7e36c9da7"},
+		{algo: "sha384", wantHash: "cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7"},
+		{algo: "sha512/224", wantHash: "4634270f707b6a54daae7530460842e20e37ed265ceee9a43e8924aa"},
+		{algo: "sha512/256", wantHash: "53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23"},
+		{algo: "sha3-224", wantHash: "e642824c3f8cf24ad09234ee7d3c766fc9a3a5168d0c94ad73b46fdf"},
+		{algo: "SHA3-256", wantHash: "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{algo: "sha3-384", wantHash: "ec01498288516fc926459f58e2c6ad8df9b473cb0fc08c2596da7cf0e49be4b298d88cea927ac7f539f1edf228376d25"},
+		{algo: "sha3-512", wantHash: "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0"},
+		{algo: "blake2b-256", wantHash: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{algo: "blake2b-384", wantHash: "6f56a82c8e7ef526dfe182eb5212f7db9df1317e57815dbda46083fc30f54ee6c66ba83be64b302d7cba6ce15bb556f4"},
+		{algo: "blake2b-512", wantHash: "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{algo: "blake2s-256", wantHash: "508c5e8c327c14e2e1a72ba34eeb452f37458b209ed63a294d999b4c86675982"},
+		{algo: "blake3", wantHash: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{algo: "crc32", wantHash: "352441c2"},
+		{algo: "crc32c", wantHash: "364b3fb7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algo, func(t *testing.T) {
+			gotHash, err := ComputeChecksum(strings.NewReader("abc"), tt.algo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ComputeChecksum() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotHash != tt.wantHash {
+				t.Errorf("ComputeChecksum() = %v, want %v", gotHash, tt.wantHash)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("Adler32", func() hash.Hash { return adler32.New() })
+
+	gotHash, err := ComputeChecksum(strings.NewReader("abc"), "adler32")
+	if err != nil {
+		t.Fatalf("ComputeChecksum() error = %v", err)
+	}
+	if want := "024d0127"; gotHash != want {
+		t.Errorf("ComputeChecksum() = %v, want %v", gotHash, want)
+	}
+
+	found := false
+	for _, name := range Algorithms() {
+		if name == "adler32" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Algorithms() = %v, want adler32 included", Algorithms())
+	}
+
+	tests := []struct {
+		name    string
+		algo    string
+		newFunc func() hash.Hash
+	}{
+		{name: "duplicated algorithm", algo: "SHA256", newFunc: func() hash.Hash { return adler32.New() }},
+		{name: "empty algorithm name", algo: " ", newFunc: func() hash.Hash { return adler32.New() }},
+		{name: "nil hash function", algo: "adler32-nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register() should panic")
+				}
+			}()
+			Register(tt.algo, tt.newFunc)
+		})
+	}
+}
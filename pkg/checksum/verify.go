@@ -0,0 +1,224 @@
+package checksum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Status represents the verification status of a checksum file line.
+type Status uint8
+
+const (
+	// StatusOK means that the computed checksum matches.
+	StatusOK Status = iota
+	// StatusFailed means that the computed checksum does not match.
+	StatusFailed
+	// StatusMissing means that the listed file can not be read.
+	StatusMissing
+	// StatusMalformed means that the checksum line is improperly formatted.
+	StatusMalformed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusFailed:
+		return "FAILED"
+	case StatusMissing:
+		return "MISSING"
+	case StatusMalformed:
+		return "MALFORMED"
+	default:
+		return fmt.Sprintf("Status(%d)", s)
+	}
+}
+
+// VerifyOptions represents the checksum file verification options.
+type VerifyOptions struct {
+	// Algo is the hash algorithm used for GNU-style lines.
+	// If empty then it is inferred from the digest length (`md5`, `sha1`, `sha224`, `sha256`, `sha384` or `sha512`).
+	// BSD-style lines always use the algorithm of their tag.
+	Algo string
+	// IgnoreMissing doesn't fail or report status for missing files (`--ignore-missing`).
+	IgnoreMissing bool
+	// Strict fails the verification on improperly formatted lines (`--strict`).
+	Strict bool
+	// Quiet doesn't report successfully verified files (`--quiet`).
+	Quiet bool
+}
+
+// VerifyResult represents the verification result of a checksum file line.
+type VerifyResult struct {
+	// Line is the checksum file line number starting at 1.
+	Line int
+	// File is the resolved path of the listed file.
+	File string
+	// Algo is the hash algorithm used.
+	Algo string
+	// Status is the verification status.
+	Status Status
+	// Err is the error which caused a non-OK status.
+	Err error
+}
+
+// defaultAlgos maps hex-encoded digest lengths to GNU coreutils algorithms.
+var defaultAlgos = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	56:  "sha224",
+	64:  "sha256",
+	96:  "sha384",
+	128: "sha512",
+}
+
+// bsdAlgos maps BSD tags which don't match a registered algorithm name (e.g. `b2sum --tag`).
+var bsdAlgos = map[string]string{
+	"blake2b": "blake2b-512",
+	"blake2s": "blake2s-256",
+}
+
+// VerifyChecksumFile verifies the files listed in a checksum file like `sha256sum -c` does.
+// Both GNU (`hash  file`) and BSD (`SHA256 (file) = hash`) line formats are supported.
+// Relative file names are resolved relative to the checksum file directory.
+// It returns a result per line and an error if the verification failed.
+func VerifyChecksumFile(path string, opts VerifyOptions) ([]VerifyResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []VerifyResult
+	var verified, failed, missing, malformed int
+	dir := filepath.Dir(path)
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res := VerifyResult{Line: n}
+		algo, sum, file, err := parseChecksumLine(line, opts.Algo)
+		if err != nil {
+			malformed++
+			res.Status = StatusMalformed
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		res.File = file
+		res.Algo = algo
+		r, err := os.Open(file)
+		if err != nil {
+			if opts.IgnoreMissing && os.IsNotExist(err) {
+				continue
+			}
+			missing++
+			res.Status = StatusMissing
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		got, err := ComputeChecksum(r, algo)
+		r.Close()
+		if err != nil {
+			missing++
+			res.Status = StatusMissing
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		verified++
+		if got != sum {
+			failed++
+			res.Status = StatusFailed
+			res.Err = fmt.Errorf("computed checksum `%s` does not match `%s`", got, sum)
+			results = append(results, res)
+			continue
+		}
+		if !opts.Quiet {
+			results = append(results, res)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return results, err
+	}
+
+	switch {
+	case verified+failed+missing == 0 && malformed > 0:
+		return results, fmt.Errorf("%s: no properly formatted checksum lines found", path)
+	case failed > 0:
+		return results, fmt.Errorf("%s: %d computed checksum(s) did not match", path, failed)
+	case missing > 0:
+		return results, fmt.Errorf("%s: %d listed file(s) could not be read", path, missing)
+	case opts.Strict && malformed > 0:
+		return results, fmt.Errorf("%s: %d line(s) are improperly formatted", path, malformed)
+	case opts.IgnoreMissing && verified == 0:
+		return results, fmt.Errorf("%s: no file was verified", path)
+	}
+	return results, nil
+}
+
+// parseChecksumLine parses a GNU or BSD checksum line returning its algorithm, lower-case digest and file name.
+func parseChecksumLine(line string, algo string) (string, string, string, error) {
+	// GNU lines with backslashes or newlines in file names are escaped and prefixed by a backslash
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	var sum, file string
+	if i := strings.Index(line, " "); i > 0 && i+1 < len(line) && (line[i+1] == ' ' || line[i+1] == '*') && isHex(line[:i]) {
+		// GNU format: `hash  file` (text mode) or `hash *file` (binary mode)
+		sum = line[:i]
+		file = line[i+2:]
+		if strings.TrimSpace(algo) == "" {
+			algo = defaultAlgos[len(sum)]
+		}
+	} else {
+		// BSD format: `ALGO (file) = hash`
+		i := strings.Index(line, " (")
+		j := strings.LastIndex(line, ") = ")
+		if i <= 0 || j < i {
+			return "", "", "", fmt.Errorf("improperly formatted checksum line")
+		}
+		algo = strings.ToLower(line[:i])
+		if a, ok := bsdAlgos[algo]; ok {
+			algo = a
+		}
+		file = line[i+2 : j]
+		sum = line[j+4:]
+	}
+	if escaped {
+		file = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(file)
+	}
+	algo = normalizeAlgo(algo)
+	if file == "" || algo == "" {
+		return "", "", "", fmt.Errorf("improperly formatted checksum line")
+	}
+	h, err := NewHash(algo)
+	if err != nil {
+		return "", "", "", err
+	}
+	sum = strings.ToLower(sum)
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != h.Size() {
+		return "", "", "", fmt.Errorf("invalid `%s` checksum `%s`", algo, sum)
+	}
+	return algo, sum, file, nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,142 @@
+package checksum
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyChecksumFile(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	if err := ioutil.WriteFile(filepath.Join(tmpDirPath, "a.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDirPath, "b (x).txt"), []byte("world\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	const (
+		sumA = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+		sumB = "e258d248fda94c63753607f7c4494ee0fcbe92f1a76bfdac795c9d84101eb317"
+	)
+	tests := []struct {
+		name       string
+		content    string
+		opts       VerifyOptions
+		wantStatus []Status
+		wantErr    bool
+	}{
+		{
+			name:       "gnu format",
+			content:    sumA + "  a.txt\n" + sumB + " *b (x).txt\n",
+			wantStatus: []Status{StatusOK, StatusOK},
+		},
+		{
+			name: "bsd format",
+			content: "SHA256 (a.txt) = " + sumA + "\n" +
+				"MD5 (a.txt) = b1946ac92492d2347c6235b4d2611184\n" +
+				"BLAKE2b (a.txt) = f60ce482e5cc1229f39d71313171a8d9f4ca3a87d066bf4b205effb528192a75f14f3271e2c1a90e1de53f275b4d4793eef2f5e31ea90d2ce29d2e481c36435f\n" +
+				"SHA256 (b (x).txt) = " + sumB + "\n",
+			wantStatus: []Status{StatusOK, StatusOK, StatusOK, StatusOK},
+		},
+		{
+			name:       "explicit algorithm",
+			content:    "b314e28493eae9dab57ac4f0c6d887bddbbeb810e900d818395ace558e96516d  a.txt\n",
+			opts:       VerifyOptions{Algo: "sha3-256"},
+			wantStatus: []Status{StatusOK},
+		},
+		{
+			name:       "quiet mode",
+			content:    sumA + "  a.txt\n" + sumA + "  b (x).txt\n",
+			opts:       VerifyOptions{Quiet: true},
+			wantStatus: []Status{StatusFailed},
+			wantErr:    true,
+		},
+		{
+			name:       "missing file",
+			content:    sumA + "  a.txt\n" + sumA + "  c.txt\n",
+			wantStatus: []Status{StatusOK, StatusMissing},
+			wantErr:    true,
+		},
+		{
+			name:       "ignore missing file",
+			content:    sumA + "  a.txt\n" + sumA + "  c.txt\n",
+			opts:       VerifyOptions{IgnoreMissing: true},
+			wantStatus: []Status{StatusOK},
+		},
+		{
+			name:       "ignore missing files without verified files",
+			content:    sumA + "  c.txt\n",
+			opts:       VerifyOptions{IgnoreMissing: true},
+			wantStatus: nil,
+			wantErr:    true,
+		},
+		{
+			name:       "malformed line",
+			content:    "# comment\n\n" + sumA + "  a.txt\nnot a checksum line\n" + sumA[:10] + "  a.txt\n",
+			wantStatus: []Status{StatusOK, StatusMalformed, StatusMalformed},
+		},
+		{
+			name:       "malformed line in strict mode",
+			content:    sumA + "  a.txt\nnot a checksum line\n",
+			opts:       VerifyOptions{Strict: true},
+			wantStatus: []Status{StatusOK, StatusMalformed},
+			wantErr:    true,
+		},
+		{
+			name:       "no properly formatted lines",
+			content:    "not a checksum line\n",
+			wantStatus: []Status{StatusMalformed},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDirPath, "SHA256SUMS")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("%v", err)
+			}
+			got, err := VerifyChecksumFile(path, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyChecksumFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var gotStatus []Status
+			for _, r := range got {
+				gotStatus = append(gotStatus, r.Status)
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("VerifyChecksumFile() = %v, want %v", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksumFileCreated(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	file := filepath.Join(tmpDirPath, "file.txt")
+	if err := ioutil.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	files, err := CreateChecksumFiles([]string{file}, []string{"sha512", "blake3"}, filepath.Join(tmpDirPath, "CHECKSUM.txt"), true)
+	if err != nil {
+		t.Fatalf("CreateChecksumFiles() error = %v", err)
+	}
+	opts := []VerifyOptions{{}, {Algo: "blake3"}}
+	for i, f := range files {
+		got, err := VerifyChecksumFile(f, opts[i])
+		if err != nil || len(got) != 1 || got[0].Status != StatusOK || got[0].File != file {
+			t.Errorf("VerifyChecksumFile() = %v, %v, want %v OK", got, err, file)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package download provides an HTTP handler which serves directories as on-the-fly Zip or Tar/Gzip archives.
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joseluisq/compactor/pkg/archive"
+)
+
+// Format represents an archive format served by the handler.
+type Format struct {
+	// Ext is the file name extension (without the leading dot).
+	Ext string
+	// ContentType is the MIME type sent as `Content-Type` header.
+	ContentType string
+	write       func(basePath string, src string, w io.Writer) error
+}
+
+var (
+	// FormatZip represents the Zip download format.
+	FormatZip = Format{Ext: "zip", ContentType: "application/zip", write: archive.CreateZipballBytes}
+	// FormatTar represents the Tar/Gzip download format.
+	FormatTar = Format{Ext: "tar.gz", ContentType: "application/gzip", write: archive.CreateTarballBytes}
+)
+
+// Handler streams a requested directory or file located under a root directory as a Zip or Tar/Gzip archive.
+// The requested path is taken from the URL path (use `http.StripPrefix` when the handler is mounted under a prefix).
+// The archive format is chosen by the `format` query parameter (`zip`, `tar.gz` or `tgz`),
+// then by the highest weighted media type of the `Accept` request header,
+// falling back to Zip otherwise (or Tar/Gzip when Zip is refused with `q=0`).
+type Handler struct {
+	root string
+}
+
+// NewHandler returns a new download handler which serves files located under the root directory.
+func NewHandler(root string) (*Handler, error) {
+	root, err := filepath.Abs(strings.TrimSpace(root))
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("root path `%s` is not a directory", root)
+	}
+	return &Handler{root: root}, nil
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	format, ok := negotiateFormat(r)
+	if !ok {
+		http.Error(w, "archive format requested is not supported", http.StatusBadRequest)
+		return
+	}
+	src, err := h.resolve(r.URL.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	name := filepath.Base(src)
+	if src == h.root {
+		// The root directory is archived with its entries placed at top level
+		name = filepath.Base(h.root)
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": name + "." + format.Ext,
+	}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	basePath, file := filepath.Dir(src), filepath.Base(src)
+	if src == h.root {
+		basePath, file = h.root, ""
+	}
+	cw := &ctxWriter{ctx: r.Context(), w: w}
+	if err := format.write(basePath, file, cw); err != nil {
+		if !cw.written {
+			// The error message is not an attachment
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "archive can not be created", http.StatusInternalServerError)
+			return
+		}
+		// Headers are already sent so abort the response
+		// in order to let the client know that the download is incomplete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// resolve maps an URL path to an absolute file path making sure that it does not escape the root directory.
+func (h *Handler) resolve(urlPath string) (string, error) {
+	p := filepath.Join(h.root, filepath.FromSlash(path.Clean("/"+urlPath)))
+	p, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(h.root, p)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path `%s` escapes the root directory", urlPath)
+	}
+	return p, nil
+}
+
+// negotiateFormat determines the archive format using the `format` query parameter or the `Accept` header.
+func negotiateFormat(r *http.Request) (Format, bool) {
+	if q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); q != "" {
+		switch q {
+		case "zip":
+			return FormatZip, true
+		case "tar.gz", "tgz":
+			return FormatTar, true
+		default:
+			return Format{}, false
+		}
+	}
+	// The highest weighted media type wins, the first one listed on ties
+	var best Format
+	bestQ := 0.0
+	refused := map[string]bool{}
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		var format Format
+		switch mediaType {
+		case "application/zip", "application/x-zip-compressed":
+			format = FormatZip
+		case "application/gzip", "application/x-gzip", "application/x-gtar", "application/x-tar":
+			format = FormatTar
+		default:
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q == 0 {
+			refused[format.Ext] = true
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	if bestQ > 0 {
+		return best, true
+	}
+	switch {
+	case !refused[FormatZip.Ext]:
+		return FormatZip, true
+	case !refused[FormatTar.Ext]:
+		return FormatTar, true
+	default:
+		return Format{}, false
+	}
+}
+
+// ctxWriter is a writer which stops writing as soon as its context is done.
+type ctxWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	written bool
+}
+
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	cw.written = true
+	return cw.w.Write(p)
+}
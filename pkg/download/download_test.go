@@ -0,0 +1,291 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func createTree(t *testing.T) (string, string) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	root := filepath.Join(tmpDirPath, "root")
+	if err := os.MkdirAll(filepath.Join(root, "docs", "sub"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	files := map[string]string{
+		filepath.Join(root, "docs", "a.txt"):        "aaa",
+		filepath.Join(root, "docs", "sub", "b.txt"): "bbb",
+		filepath.Join(tmpDirPath, "secret.txt"):     "secret",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(tmpDirPath, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.Symlink(tmpDirPath, filepath.Join(root, "docs", "outside")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return tmpDirPath, root
+}
+
+func zipEntries(t *testing.T, data []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func tarEntries(t *testing.T, data []byte) []string {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestHandler(t *testing.T) {
+	tmpDirPath, root := createTree(t)
+	defer os.RemoveAll(tmpDirPath)
+
+	h, err := NewHandler(root)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantDisp    string
+		wantEntries []string
+	}{
+		{
+			name:        "zip directory by default",
+			target:      "/docs",
+			wantStatus:  http.StatusOK,
+			wantType:    "application/zip",
+			wantDisp:    "attachment; filename=docs.zip",
+			wantEntries: []string{"docs/", "docs/a.txt", "docs/outside", "docs/sub/", "docs/sub/b.txt"},
+		},
+		{
+			name:        "tarball directory by query parameter",
+			target:      "/docs/sub?format=tar.gz",
+			wantStatus:  http.StatusOK,
+			wantType:    "application/gzip",
+			wantDisp:    "attachment; filename=sub.tar.gz",
+			wantEntries: []string{"sub", "sub/b.txt"},
+		},
+		{
+			name:        "tarball directory by accept header",
+			target:      "/docs/sub",
+			accept:      "text/html, application/gzip;q=0.9",
+			wantStatus:  http.StatusOK,
+			wantType:    "application/gzip",
+			wantEntries: []string{"sub", "sub/b.txt"},
+		},
+		{
+			name:        "highest weighted accept header format",
+			target:      "/docs/sub",
+			accept:      "application/zip;q=0.5, application/gzip;q=0.8",
+			wantStatus:  http.StatusOK,
+			wantType:    "application/gzip",
+			wantEntries: []string{"sub", "sub/b.txt"},
+		},
+		{
+			name:       "accept header refusing a format",
+			target:     "/docs/sub",
+			accept:     "application/gzip;q=0",
+			wantStatus: http.StatusOK,
+			wantType:   "application/zip",
+		},
+		{
+			name:       "accept header refusing zip",
+			target:     "/docs/sub",
+			accept:     "text/html, application/zip;q=0",
+			wantStatus: http.StatusOK,
+			wantType:   "application/gzip",
+		},
+		{
+			name:       "accept header refusing all formats",
+			target:     "/docs/sub",
+			accept:     "application/zip;q=0, application/gzip;q=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "root directory",
+			target:      "/?format=zip",
+			wantStatus:  http.StatusOK,
+			wantDisp:    "attachment; filename=root.zip",
+			wantEntries: []string{"docs/", "docs/a.txt", "docs/outside", "docs/sub/", "docs/sub/b.txt", "escape.txt"},
+		},
+		{
+			name:       "head request",
+			method:     http.MethodHead,
+			target:     "/docs?format=tgz",
+			wantStatus: http.StatusOK,
+			wantType:   "application/gzip",
+			wantDisp:   "attachment; filename=docs.tar.gz",
+		},
+		{
+			name:       "unsupported format",
+			target:     "/docs?format=rar",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodPost,
+			target:     "/docs",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "not found path",
+			target:     "/docs/none",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "dot-dot path is kept inside root",
+			target:     "/../../docs/sub?format=tgz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "symbolic link escaping root",
+			target:     "/escape.txt",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "symbolic link directory escaping root",
+			target:     "/docs/outside",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			res := rec.Result()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("ServeHTTP() status = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if tt.wantType != "" && res.Header.Get("Content-Type") != tt.wantType {
+				t.Errorf("ServeHTTP() Content-Type = %v, want %v", res.Header.Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantDisp != "" && res.Header.Get("Content-Disposition") != tt.wantDisp {
+				t.Errorf("ServeHTTP() Content-Disposition = %v, want %v", res.Header.Get("Content-Disposition"), tt.wantDisp)
+			}
+			if tt.wantEntries == nil {
+				return
+			}
+			var got []string
+			if res.Header.Get("Content-Type") == "application/zip" {
+				got = zipEntries(t, rec.Body.Bytes())
+			} else {
+				got = tarEntries(t, rec.Body.Bytes())
+			}
+			if len(got) != len(tt.wantEntries) {
+				t.Fatalf("ServeHTTP() entries = %v, want %v", got, tt.wantEntries)
+			}
+			for i := range got {
+				if got[i] != tt.wantEntries[i] {
+					t.Errorf("ServeHTTP() entries = %v, want %v", got, tt.wantEntries)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerCanceledRequest(t *testing.T) {
+	tmpDirPath, root := createTree(t)
+	defer os.RemoveAll(tmpDirPath)
+
+	h, err := NewHandler(root)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ServeHTTP() status = %v, want %v", rec.Code, http.StatusInternalServerError)
+	}
+	if disp := rec.Header().Get("Content-Disposition"); disp != "" {
+		t.Errorf("ServeHTTP() Content-Disposition = %v, want none", disp)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		wantErr bool
+	}{
+		{
+			name:    "invalid root directory",
+			root:    "../archive/fixtures/some",
+			wantErr: true,
+		},
+		{
+			name:    "root file instead of directory",
+			root:    "../archive/fixtures/file.txt",
+			wantErr: true,
+		},
+		{
+			name: "valid root directory",
+			root: "../archive/fixtures",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHandler(tt.root); (err != nil) != tt.wantErr {
+				t.Errorf("NewHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
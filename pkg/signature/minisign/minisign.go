@@ -0,0 +1,454 @@
+// Package minisign implements the minisign key and signature file formats
+// so that files signed by compactor can be verified using the `minisign` tool and vice versa.
+// See https://jedisct1.github.io/minisign/ for the format specification.
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Ext is the file name extension of minisign signature files.
+const Ext = ".minisig"
+
+const (
+	algEd       = "Ed"
+	algHashedEd = "ED"
+	kdfScrypt   = "Sc"
+	kdfNone     = "\x00\x00"
+	chkBlake2b  = "B2"
+
+	// Default scrypt limits used by minisign for encrypted secret keys.
+	defaultOpsLimit = 1 << 25
+	defaultMemLimit = 1 << 30
+
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+
+	secretKeySize = 2 + 2 + 2 + 32 + 8 + 8 + 8 + ed25519.PrivateKeySize + 32
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match the signed data.
+	ErrInvalidSignature = errors.New("minisign: invalid signature")
+	// ErrKeyMismatch is returned when a signature was created by a different key than the one used for verification.
+	ErrKeyMismatch = errors.New("minisign: signature key ID does not match the public key ID")
+	// ErrWrongPassword is returned when an encrypted secret key can not be decrypted.
+	ErrWrongPassword = errors.New("minisign: wrong password for secret key")
+)
+
+// PublicKey represents a minisign public key.
+type PublicKey struct {
+	// ID is the key identifier shared by the key pair.
+	ID uint64
+	// Key is the Ed25519 public key.
+	Key ed25519.PublicKey
+}
+
+// PrivateKey represents a minisign secret key.
+type PrivateKey struct {
+	// ID is the key identifier shared by the key pair.
+	ID uint64
+	// Key is the Ed25519 private key.
+	Key ed25519.PrivateKey
+}
+
+// Public returns the public key corresponding to the private key.
+func (k PrivateKey) Public() PublicKey {
+	return PublicKey{ID: k.ID, Key: k.Key.Public().(ed25519.PublicKey)}
+}
+
+// SignOptions represents the minisign signing options.
+type SignOptions struct {
+	// Legacy signs the data itself instead of its BLAKE2b-512 digest (prehashed mode, the minisign default).
+	// Legacy signatures require loading all the data in memory.
+	Legacy bool
+	// TrustedComment is signed along with the signature. It defaults to the signing timestamp.
+	TrustedComment string
+	// UntrustedComment is informational only. It defaults to `signature from minisign secret key`.
+	UntrustedComment string
+}
+
+// GenerateKey generates a new minisign key pair with a random key ID.
+func GenerateKey() (PublicKey, PrivateKey, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return PublicKey{}, PrivateKey{}, err
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return PublicKey{}, PrivateKey{}, err
+	}
+	keyID := binary.LittleEndian.Uint64(id[:])
+	return PublicKey{ID: keyID, Key: pub}, PrivateKey{ID: keyID, Key: priv}, nil
+}
+
+// GenerateKeyFiles generates a new minisign key pair and saves it into key files.
+// If password is empty then the secret key is saved unencrypted (like `minisign -G -W`).
+func GenerateKeyFiles(privateKeyPath string, publicKeyPath string, password string) error {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	data, err := EncodePrivateKey(priv, password)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(privateKeyPath, data, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(publicKeyPath, EncodePublicKey(pub), 0644)
+}
+
+// EncodePublicKey returns the minisign public key file content.
+func EncodePublicKey(key PublicKey) []byte {
+	b := make([]byte, 0, 2+8+ed25519.PublicKeySize)
+	b = append(b, algEd...)
+	b = appendID(b, key.ID)
+	b = append(b, key.Key...)
+	return encodeLines(fmt.Sprintf("minisign public key %016X", key.ID), b)
+}
+
+// ParsePublicKey parses a minisign public key file content or its base64-encoded line only.
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	lines := splitLines(data)
+	if len(lines) > 0 && strings.HasPrefix(lines[0], untrustedPrefix) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return PublicKey{}, errors.New("minisign: public key is empty")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("minisign: malformed public key: %w", err)
+	}
+	if len(b) != 2+8+ed25519.PublicKeySize || string(b[:2]) != algEd {
+		return PublicKey{}, errors.New("minisign: unsupported public key format")
+	}
+	return PublicKey{
+		ID:  binary.LittleEndian.Uint64(b[2:10]),
+		Key: ed25519.PublicKey(b[10:]),
+	}, nil
+}
+
+// ReadPublicKey reads a minisign public key file.
+func ReadPublicKey(path string) (PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	return ParsePublicKey(data)
+}
+
+// EncodePrivateKey returns the minisign secret key file content encrypted with a password using scrypt.
+// If password is empty then the secret key is encoded unencrypted.
+func EncodePrivateKey(key PrivateKey, password string) ([]byte, error) {
+	return encodePrivateKey(key, password, defaultOpsLimit, defaultMemLimit)
+}
+
+func encodePrivateKey(key PrivateKey, password string, opsLimit uint64, memLimit uint64) ([]byte, error) {
+	if len(key.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("minisign: invalid Ed25519 private key size %d", len(key.Key))
+	}
+	b := make([]byte, 0, secretKeySize)
+	b = append(b, algEd...)
+	var salt [32]byte
+	if password == "" {
+		b = append(b, kdfNone...)
+		opsLimit, memLimit = 0, 0
+	} else {
+		b = append(b, kdfScrypt...)
+		if _, err := rand.Read(salt[:]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, chkBlake2b...)
+	b = append(b, salt[:]...)
+	b = appendUint64(b, opsLimit)
+	b = appendUint64(b, memLimit)
+	keyStart := len(b)
+	b = appendID(b, key.ID)
+	b = append(b, key.Key...)
+	b = append(b, keyChecksum(key)...)
+	if password != "" {
+		stream, err := deriveStream(password, salt[:], opsLimit, memLimit, len(b)-keyStart)
+		if err != nil {
+			return nil, err
+		}
+		xorBytes(b[keyStart:], stream)
+	}
+	comment := "minisign secret key"
+	if password != "" {
+		comment = "minisign encrypted secret key"
+	}
+	return encodeLines(comment, b), nil
+}
+
+// ParsePrivateKey parses a minisign secret key file content decrypting it with a password if it's encrypted.
+func ParsePrivateKey(data []byte, password string) (PrivateKey, error) {
+	lines := splitLines(data)
+	if len(lines) > 0 && strings.HasPrefix(lines[0], untrustedPrefix) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return PrivateKey{}, errors.New("minisign: secret key is empty")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("minisign: malformed secret key: %w", err)
+	}
+	if len(b) != secretKeySize || string(b[:2]) != algEd || string(b[4:6]) != chkBlake2b {
+		return PrivateKey{}, errors.New("minisign: unsupported secret key format")
+	}
+	kdf := string(b[2:4])
+	salt := b[6:38]
+	opsLimit := binary.LittleEndian.Uint64(b[38:46])
+	memLimit := binary.LittleEndian.Uint64(b[46:54])
+	keyData := b[54:]
+	switch kdf {
+	case kdfNone:
+	case kdfScrypt:
+		stream, err := deriveStream(password, salt, opsLimit, memLimit, len(keyData))
+		if err != nil {
+			return PrivateKey{}, err
+		}
+		xorBytes(keyData, stream)
+	default:
+		return PrivateKey{}, fmt.Errorf("minisign: unsupported secret key derivation %q", kdf)
+	}
+	key := PrivateKey{
+		ID:  binary.LittleEndian.Uint64(keyData[:8]),
+		Key: ed25519.PrivateKey(keyData[8 : 8+ed25519.PrivateKeySize]),
+	}
+	if subtle.ConstantTimeCompare(keyChecksum(key), keyData[8+ed25519.PrivateKeySize:]) != 1 {
+		if kdf == kdfScrypt {
+			return PrivateKey{}, ErrWrongPassword
+		}
+		return PrivateKey{}, errors.New("minisign: secret key checksum mismatch")
+	}
+	return key, nil
+}
+
+// ReadPrivateKey reads a minisign secret key file decrypting it with a password if it's encrypted.
+func ReadPrivateKey(path string, password string) (PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return ParsePrivateKey(data, password)
+}
+
+// Sign signs the data read from r and returns the minisign signature file content.
+func Sign(key PrivateKey, r io.Reader, opts SignOptions) ([]byte, error) {
+	if len(key.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("minisign: invalid Ed25519 private key size %d", len(key.Key))
+	}
+	alg, msg, err := message(r, opts.Legacy)
+	if err != nil {
+		return nil, err
+	}
+	trusted := opts.TrustedComment
+	if trusted == "" {
+		trusted = fmt.Sprintf("timestamp:%d", time.Now().Unix())
+	}
+	untrusted := opts.UntrustedComment
+	if untrusted == "" {
+		untrusted = "signature from minisign secret key"
+	}
+	if strings.ContainsAny(trusted+untrusted, "\r\n") {
+		return nil, errors.New("minisign: comments must be single lines")
+	}
+	sig := ed25519.Sign(key.Key, msg)
+	globalSig := ed25519.Sign(key.Key, append(append([]byte{}, sig...), trusted...))
+
+	b := make([]byte, 0, 2+8+ed25519.SignatureSize)
+	b = append(b, alg...)
+	b = appendID(b, key.ID)
+	b = append(b, sig...)
+	var buf bytes.Buffer
+	buf.Write(encodeLines(untrusted, b))
+	buf.WriteString(trustedPrefix + trusted + "\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(globalSig) + "\n")
+	return buf.Bytes(), nil
+}
+
+// Verify checks a minisign signature file content against the data read from r.
+// Both prehashed and legacy signatures are supported. It returns the verified trusted comment.
+func Verify(key PublicKey, r io.Reader, sig []byte) (string, error) {
+	lines := splitLines(sig)
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], untrustedPrefix) || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return "", errors.New("minisign: malformed signature")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(b) != 2+8+ed25519.SignatureSize {
+		return "", errors.New("minisign: malformed signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return "", errors.New("minisign: malformed trusted comment signature")
+	}
+	alg := string(b[:2])
+	if alg != algEd && alg != algHashedEd {
+		return "", fmt.Errorf("minisign: unsupported signature algorithm %q", alg)
+	}
+	if binary.LittleEndian.Uint64(b[2:10]) != key.ID {
+		return "", ErrKeyMismatch
+	}
+	if len(key.Key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("minisign: invalid Ed25519 public key size %d", len(key.Key))
+	}
+	_, msg, err := message(r, alg == algEd)
+	if err != nil {
+		return "", err
+	}
+	trusted := strings.TrimPrefix(lines[2], trustedPrefix)
+	if !ed25519.Verify(key.Key, msg, b[10:]) || !ed25519.Verify(key.Key, append(append([]byte{}, b[10:]...), trusted...), globalSig) {
+		return "", ErrInvalidSignature
+	}
+	return trusted, nil
+}
+
+// SignFile signs a file (e.g. a checksum file) and saves the signature into a `.minisig` file next to it.
+// The trusted comment defaults to the signing timestamp and the file name like minisign does.
+// It returns the signature file path or an error.
+func SignFile(key PrivateKey, file string, opts SignOptions) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if opts.TrustedComment == "" {
+		opts.TrustedComment = fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), filepath.Base(file))
+		if !opts.Legacy {
+			opts.TrustedComment += "\thashed"
+		}
+	}
+	sig, err := Sign(key, f, opts)
+	if err != nil {
+		return "", err
+	}
+	sigFile := file + Ext
+	if err := ioutil.WriteFile(sigFile, sig, 0644); err != nil {
+		return "", err
+	}
+	return sigFile, nil
+}
+
+// VerifyFile checks a file against its minisign signature file.
+// If sigFile is empty then the `.minisig` file next to the file is used.
+// It returns the verified trusted comment.
+func VerifyFile(key PublicKey, file string, sigFile string) (string, error) {
+	if strings.TrimSpace(sigFile) == "" {
+		sigFile = file + Ext
+	}
+	sig, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Verify(key, f, sig)
+}
+
+// message returns the signature algorithm and the message actually signed for the data read from r.
+func message(r io.Reader, legacy bool) (string, []byte, error) {
+	if legacy {
+		data, err := ioutil.ReadAll(r)
+		return algEd, data, err
+	}
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, r); err != nil {
+		return "", nil, err
+	}
+	return algHashedEd, h.Sum(nil), nil
+}
+
+// keyChecksum computes the BLAKE2b-256 checksum protecting a secret key.
+func keyChecksum(key PrivateKey) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(algEd))
+	h.Write(appendID(nil, key.ID))
+	h.Write(key.Key)
+	return h.Sum(nil)
+}
+
+// deriveStream derives the secret key encryption stream using scrypt parameters picked like libsodium does.
+func deriveStream(password string, salt []byte, opsLimit uint64, memLimit uint64, size int) ([]byte, error) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+	r := uint64(8)
+	var nLog2, p uint64
+	if opsLimit < memLimit/32 {
+		p = 1
+		maxN := opsLimit / (r * 4)
+		for nLog2 = 1; nLog2 < 63; nLog2++ {
+			if uint64(1)<<nLog2 > maxN/2 {
+				break
+			}
+		}
+	} else {
+		maxN := memLimit / (r * 128)
+		for nLog2 = 1; nLog2 < 63; nLog2++ {
+			if uint64(1)<<nLog2 > maxN/2 {
+				break
+			}
+		}
+		maxRP := (opsLimit / 4) / (uint64(1) << nLog2)
+		if maxRP > 0x3fffffff {
+			maxRP = 0x3fffffff
+		}
+		p = maxRP / r
+	}
+	return scrypt.Key([]byte(password), salt, 1<<nLog2, int(r), int(p), size)
+}
+
+// encodeLines encodes an untrusted comment line followed by a base64-encoded data line.
+func encodeLines(comment string, data []byte) []byte {
+	return []byte(untrustedPrefix + comment + "\n" + base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+// splitLines splits data into non-empty lines.
+func splitLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func appendID(b []byte, id uint64) []byte {
+	return appendUint64(b, id)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func xorBytes(dst []byte, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,178 @@
+package minisign
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Signatures created by the minisign tool over the message `test`.
+const (
+	testPublicKey = "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+	testLegacySig = "untrusted comment: signature from minisign secret key\n" +
+		"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+		"trusted comment: timestamp:1635442742\tfile:test\n" +
+		"0YteLgV960ia80vnA/fHbvkyjl/IoP/HNOCaZfrF0CdhAlp7ok+Tpkya+VpWPX5C/Is3q8a/kEDSY7fBmmgJCg==\n"
+	testPrehashedSig = "untrusted comment: signature from minisign secret key\n" +
+		"RUQf6LRCGA9i559r3g7V1qNyJDApGip8MfqcadIgT9CuhV3EMhHoN1mGTkUidF/z7SrlQgXdy8ofjb7bNJJylDOocrCo8KLzZwo=\n" +
+		"trusted comment: timestamp:1635443258\tfile:test\thashed\n" +
+		"/cj37GK60vryibFn+ftOgbCvW9NKhKYgjVpFFQUcWPAnjO23wrvVDTt7cloNC06maoBli9q6qwZDXXoaxweICQ==\n"
+)
+
+// Encrypted secret key (scrypt with reduced limits) and a legacy signature
+// over the message `Hello Gopher!` created with it.
+const (
+	testSecretKey = "RWRTY0IyorAWr/1gdweGki6ua7GpmoPqS+7rMBSmBy6hedA53dAAABAAAAAAAAAAAAIAAAAAwfmyB6qIIW2eGNiQaFzgs1oi52iN8cRHBPRupc9TVdfAeJvlPdvzu3TfA2DHTW2PZi98uihcr5sEB5fefFml2d0xBk72ZOGNJpOTsn95eHgEH/qUfzQZ018JfiVwWf8pNpdgNFX8ROs="
+	testPassword  = "correct horse battery staple"
+	testSecretSig = "untrusted comment: This comment is not signed and just informational\n" +
+		"RWQGPaMY2ls0CmMflCAP5J/MpaXmt+3+UoT1vRSPRjXO6w0KNtpkcQe3TxQ35kAwhjFVB6CEYYrHZmMvWjXRutefRHicRUiAJwQ=\n" +
+		"trusted comment: This comment is signed and can be trusted\n" +
+		"/jXXGSI/q3MhrZ5PKzL221/qC+JFVpgilf9su6AcTtMffw+9ShYt5LjU2RG1M/EspIoEv4xxK/36TeCQBgHbBw==\n"
+)
+
+func TestVerify(t *testing.T) {
+	pub, err := ParsePublicKey([]byte(testPublicKey))
+	if err != nil {
+		t.Fatalf("ParsePublicKey() error = %v", err)
+	}
+	tests := []struct {
+		name        string
+		message     string
+		sig         string
+		wantComment string
+		wantErr     error
+	}{
+		{
+			name:        "legacy signature",
+			message:     "test",
+			sig:         testLegacySig,
+			wantComment: "timestamp:1635442742\tfile:test",
+		},
+		{
+			name:        "prehashed signature",
+			message:     "test",
+			sig:         testPrehashedSig,
+			wantComment: "timestamp:1635443258\tfile:test\thashed",
+		},
+		{
+			name:    "tampered message",
+			message: "tesT",
+			sig:     testPrehashedSig,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered trusted comment",
+			message: "test",
+			sig:     strings.Replace(testPrehashedSig, "file:test", "file:evil", 1),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signature of another key",
+			message: "Hello Gopher!",
+			sig:     testSecretSig,
+			wantErr: ErrKeyMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(pub, strings.NewReader(tt.message), []byte(tt.sig))
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.wantComment {
+				t.Errorf("Verify() = %q, want %q", got, tt.wantComment)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	if _, err := ParsePrivateKey([]byte(testSecretKey), "wrong password"); err != ErrWrongPassword {
+		t.Errorf("ParsePrivateKey() error = %v, want %v", err, ErrWrongPassword)
+	}
+	priv, err := ParsePrivateKey([]byte(testSecretKey), testPassword)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+	if want := uint64(0xA345BDA18A33D06); priv.ID != want {
+		t.Errorf("ParsePrivateKey() ID = %X, want %X", priv.ID, want)
+	}
+
+	// Ed25519 signatures are deterministic so minisign output is reproduced byte for byte
+	got, err := Sign(priv, strings.NewReader("Hello Gopher!"), SignOptions{
+		Legacy:           true,
+		TrustedComment:   "This comment is signed and can be trusted",
+		UntrustedComment: "This comment is not signed and just informational",
+	})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if string(got) != testSecretSig {
+		t.Errorf("Sign() = %q, want %q", got, testSecretSig)
+	}
+
+	// Re-encoding with small scrypt limits keeps tests fast
+	for _, password := range []string{"", "another password"} {
+		data, err := encodePrivateKey(priv, password, 1<<20, 1<<25)
+		if err != nil {
+			t.Fatalf("encodePrivateKey() error = %v", err)
+		}
+		got, err := ParsePrivateKey(data, password)
+		if err != nil {
+			t.Fatalf("ParsePrivateKey() error = %v", err)
+		}
+		if got.ID != priv.ID || !bytes.Equal(got.Key, priv.Key) {
+			t.Errorf("ParsePrivateKey() = %X, want %X", got.ID, priv.ID)
+		}
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	privPath := filepath.Join(tmpDirPath, "minisign.key")
+	pubPath := filepath.Join(tmpDirPath, "minisign.pub")
+	if err := GenerateKeyFiles(privPath, pubPath, ""); err != nil {
+		t.Fatalf("GenerateKeyFiles() error = %v", err)
+	}
+	priv, err := ReadPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("ReadPrivateKey() error = %v", err)
+	}
+	pub, err := ReadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("ReadPublicKey() error = %v", err)
+	}
+	if pub.ID != priv.ID || !bytes.Equal(pub.Key, priv.Public().Key) {
+		t.Errorf("ReadPublicKey() = %X, want %X", pub.ID, priv.ID)
+	}
+
+	file := filepath.Join(tmpDirPath, "SHA256SUMS")
+	if err := ioutil.WriteFile(file, []byte("abc  file.tar.gz\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, legacy := range []bool{false, true} {
+		sigFile, err := SignFile(priv, file, SignOptions{Legacy: legacy})
+		if err != nil {
+			t.Fatalf("SignFile() error = %v", err)
+		}
+		if want := file + ".minisig"; sigFile != want {
+			t.Errorf("SignFile() = %v, want %v", sigFile, want)
+		}
+		comment, err := VerifyFile(pub, file, "")
+		if err != nil {
+			t.Errorf("VerifyFile() error = %v", err)
+		}
+		if !strings.Contains(comment, "\tfile:SHA256SUMS") || strings.HasSuffix(comment, "\thashed") == legacy {
+			t.Errorf("VerifyFile() trusted comment = %q", comment)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package signature provides Ed25519 key generation and detached signatures for archive and checksum files.
+//
+// Files are prehashed: the signed message is the 64-byte SHA-512 digest of the file content,
+// so PureEdDSA verifiers must be given that digest, not the file. This is neither Ed25519ph (RFC 8032)
+// nor the minisign or signify formats (see the minisign and signify packages for those).
+// A signature file holds the standard base64 encoding of the 64-byte signature followed by a newline.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Ext is the file name extension of detached signature files.
+// It differs from the signify `.sig` extension since both signatures are incompatible.
+const Ext = ".ed25519.sig"
+
+// ErrInvalidSignature is returned when a signature does not match the signed file.
+var ErrInvalidSignature = errors.New("signature: invalid signature")
+
+// GenerateKey generates a new Ed25519 key pair.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// GenerateKeyFiles generates a new Ed25519 key pair and saves it as PEM files (PKCS #8 private key and PKIX public key).
+// The private key file is only readable by its owner.
+func GenerateKeyFiles(privateKeyPath string, publicKeyPath string) error {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	privDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	privPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer})
+	if err := ioutil.WriteFile(privateKeyPath, privPem, 0600); err != nil {
+		return err
+	}
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+	return ioutil.WriteFile(publicKeyPath, pubPem, 0644)
+}
+
+// ReadPrivateKey reads an Ed25519 private key from a PEM file (PKCS #8).
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPem(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signature: %s is not an Ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+// ReadPublicKey reads an Ed25519 public key from a PEM file (PKIX).
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPem(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("signature: %s is not an Ed25519 public key", path)
+	}
+	return pub, nil
+}
+
+func readPem(path string, blockType string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("signature: %s does not contain a PEM %s block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// digestFile computes the SHA-512 digest of a file which is the message actually signed.
+// This way files of any size are signed without loading them in memory.
+func digestFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha512.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign returns the Ed25519 signature of a file.
+// The signed message is the SHA-512 digest of the file content, not the content itself.
+func Sign(key ed25519.PrivateKey, file string) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signature: invalid Ed25519 private key size %d", len(key))
+	}
+	digest, err := digestFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(key, digest), nil
+}
+
+// SignFile signs a file (e.g. an archive or checksum file) and saves the base64-encoded signature into a detached `.ed25519.sig` file next to it.
+// It returns the signature file path or an error.
+func SignFile(key ed25519.PrivateKey, file string) (string, error) {
+	sig, err := Sign(key, file)
+	if err != nil {
+		return "", err
+	}
+	sigFile := file + Ext
+	if err := ioutil.WriteFile(sigFile, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return sigFile, nil
+}
+
+// Verify checks the Ed25519 signature of a file.
+// It returns `ErrInvalidSignature` if the signature does not match.
+func Verify(key ed25519.PublicKey, file string, sig []byte) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("signature: invalid Ed25519 public key size %d", len(key))
+	}
+	digest, err := digestFile(file)
+	if err != nil {
+		return err
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(key, digest, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyFile checks a file against its detached signature file.
+// If sigFile is empty then the `.ed25519.sig` file next to the file is used.
+// It returns `ErrInvalidSignature` if the signature does not match.
+func VerifyFile(key ed25519.PublicKey, file string, sigFile string) error {
+	if strings.TrimSpace(sigFile) == "" {
+		sigFile = file + Ext
+	}
+	data, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("signature: malformed signature file %s: %w", sigFile, err)
+	}
+	return Verify(key, file, sig)
+}
@@ -0,0 +1,117 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignFile(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	privPath := filepath.Join(tmpDirPath, "key.pem")
+	pubPath := filepath.Join(tmpDirPath, "key.pub.pem")
+	if err := GenerateKeyFiles(privPath, pubPath); err != nil {
+		t.Fatalf("GenerateKeyFiles() error = %v", err)
+	}
+	if fi, err := os.Stat(privPath); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("GenerateKeyFiles() private key mode = %v, %v", fi.Mode(), err)
+	}
+	priv, err := ReadPrivateKey(privPath)
+	if err != nil {
+		t.Fatalf("ReadPrivateKey() error = %v", err)
+	}
+	pub, err := ReadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("ReadPublicKey() error = %v", err)
+	}
+	otherPub, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	file := filepath.Join(tmpDirPath, "file.sha256.tar.txt")
+	if err := ioutil.WriteFile(file, []byte("abc  file.tar.gz\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	sigFile, err := SignFile(priv, file)
+	if err != nil {
+		t.Fatalf("SignFile() error = %v", err)
+	}
+	if want := file + ".ed25519.sig"; sigFile != want {
+		t.Errorf("SignFile() = %v, want %v", sigFile, want)
+	}
+	// The signed message is the SHA-512 digest of the file, as documented for other verifiers
+	data, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(string(data), "\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	digest := sha512.Sum512([]byte("abc  file.tar.gz\n"))
+	if !ed25519.Verify(pub, digest[:], sig) {
+		t.Errorf("SignFile() signature doesn't verify over the SHA-512 digest of the file")
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		content string
+		sigFile string
+		wantErr error
+	}{
+		{
+			name: "valid signature",
+			key:  pub,
+		},
+		{
+			name:    "valid signature with explicit signature file",
+			key:     pub,
+			sigFile: sigFile,
+		},
+		{
+			name:    "wrong public key",
+			key:     otherPub,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered file",
+			key:     pub,
+			content: "def  file.tar.gz\n",
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.content != "" {
+				if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("%v", err)
+				}
+			}
+			if err := VerifyFile(tt.key, file, tt.sigFile); err != tt.wantErr {
+				t.Errorf("VerifyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := ioutil.WriteFile(sigFile, []byte("not base64!"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := VerifyFile(pub, file, ""); err == nil || err == ErrInvalidSignature {
+		t.Errorf("VerifyFile() error = %v, want malformed signature error", err)
+	}
+	if _, err := ReadPublicKey(privPath); err == nil {
+		t.Errorf("ReadPublicKey() error = %v, want wrong PEM block error", err)
+	}
+}
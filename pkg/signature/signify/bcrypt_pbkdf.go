@@ -0,0 +1,95 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE-GO file.
+
+// Adapted from golang.org/x/crypto/ssh/internal/bcrypt_pbkdf, which can't be imported.
+
+package signify
+
+import (
+	"crypto/sha512"
+	"errors"
+
+	"golang.org/x/crypto/blowfish"
+)
+
+const bcryptBlockSize = 32
+
+// bcryptMagic is the plaintext encrypted by the bcrypt hash function of bcrypt_pbkdf.
+var bcryptMagic = []byte("OxychromaticBlowfishSwatDynamite")
+
+// bcryptPBKDF derives a key with the OpenBSD bcrypt_pbkdf function used to encrypt signify secret keys.
+func bcryptPBKDF(password, salt []byte, rounds, keyLen int) ([]byte, error) {
+	if rounds < 1 {
+		return nil, errors.New("signify: bcrypt_pbkdf rounds must be at least 1")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("signify: empty passphrase")
+	}
+	if len(salt) == 0 || len(salt) > 1<<20 {
+		return nil, errors.New("signify: bad bcrypt_pbkdf salt length")
+	}
+	if keyLen < 1 || keyLen > 1024 {
+		return nil, errors.New("signify: bad bcrypt_pbkdf key length")
+	}
+
+	numBlocks := (keyLen + bcryptBlockSize - 1) / bcryptBlockSize
+	key := make([]byte, numBlocks*bcryptBlockSize)
+
+	h := sha512.New()
+	h.Write(password)
+	shapass := h.Sum(nil)
+
+	shasalt := make([]byte, 0, sha512.Size)
+	cnt, tmp := make([]byte, 4), make([]byte, bcryptBlockSize)
+	for block := 1; block <= numBlocks; block++ {
+		h.Reset()
+		h.Write(salt)
+		cnt[0] = byte(block >> 24)
+		cnt[1] = byte(block >> 16)
+		cnt[2] = byte(block >> 8)
+		cnt[3] = byte(block)
+		h.Write(cnt)
+		bcryptHash(tmp, shapass, h.Sum(shasalt[:0]))
+
+		out := make([]byte, bcryptBlockSize)
+		copy(out, tmp)
+		for i := 2; i <= rounds; i++ {
+			h.Reset()
+			h.Write(tmp)
+			bcryptHash(tmp, shapass, h.Sum(shasalt[:0]))
+			for j := range out {
+				out[j] ^= tmp[j]
+			}
+		}
+
+		// output bytes are interleaved across blocks
+		for i, v := range out {
+			key[i*numBlocks+(block-1)] = v
+		}
+	}
+	return key[:keyLen], nil
+}
+
+// bcryptHash is the modified bcrypt hash function of bcrypt_pbkdf.
+func bcryptHash(out, shapass, shasalt []byte) {
+	c, err := blowfish.NewSaltedCipher(shapass, shasalt)
+	if err != nil {
+		// only returned for invalid key sizes, SHA-512 digests are always valid
+		panic(err)
+	}
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(shasalt, c)
+		blowfish.ExpandKey(shapass, c)
+	}
+	copy(out, bcryptMagic)
+	for i := 0; i < bcryptBlockSize; i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(out[i:i+8], out[i:i+8])
+		}
+	}
+	// bcrypt_pbkdf uses the words in little-endian order
+	for i := 0; i < bcryptBlockSize; i += 4 {
+		out[i+3], out[i+2], out[i+1], out[i] = out[i], out[i+1], out[i+2], out[i+3]
+	}
+}
@@ -0,0 +1,306 @@
+// Package signify implements the OpenBSD signify key and signature file formats
+// so that files signed by compactor can be verified using the `signify` tool and vice versa.
+// Signify signs the whole content in memory, so it's meant for small files like checksum files.
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Ext is the file name extension of signify signature files.
+const Ext = ".sig"
+
+const (
+	algEd     = "Ed"
+	kdfBcrypt = "BK"
+
+	// DefaultRounds is the default amount of bcrypt_pbkdf rounds used by signify for encrypted secret keys.
+	DefaultRounds = 42
+
+	untrustedPrefix = "untrusted comment: "
+
+	publicKeySize = 2 + 8 + ed25519.PublicKeySize
+	secretKeySize = 2 + 2 + 4 + 16 + 8 + 8 + ed25519.PrivateKeySize
+	signatureSize = 2 + 8 + ed25519.SignatureSize
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match the signed data.
+	ErrInvalidSignature = errors.New("signify: invalid signature")
+	// ErrKeyMismatch is returned when a signature was created by a different key than the one used for verification.
+	ErrKeyMismatch = errors.New("signify: signature key number does not match the public key number")
+	// ErrWrongPassword is returned when an encrypted secret key can not be decrypted.
+	ErrWrongPassword = errors.New("signify: incorrect passphrase")
+)
+
+// PublicKey represents a signify public key.
+type PublicKey struct {
+	// KeyNum is the random key number shared by the key pair.
+	KeyNum [8]byte
+	// Key is the Ed25519 public key.
+	Key ed25519.PublicKey
+}
+
+// PrivateKey represents a signify secret key.
+type PrivateKey struct {
+	// KeyNum is the random key number shared by the key pair.
+	KeyNum [8]byte
+	// Key is the Ed25519 private key.
+	Key ed25519.PrivateKey
+}
+
+// Public returns the public key corresponding to the private key.
+func (k PrivateKey) Public() PublicKey {
+	return PublicKey{KeyNum: k.KeyNum, Key: k.Key.Public().(ed25519.PublicKey)}
+}
+
+// GenerateKey generates a new signify key pair with a random key number.
+func GenerateKey() (PublicKey, PrivateKey, error) {
+	var keyNum [8]byte
+	if _, err := rand.Read(keyNum[:]); err != nil {
+		return PublicKey{}, PrivateKey{}, err
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return PublicKey{}, PrivateKey{}, err
+	}
+	return PublicKey{KeyNum: keyNum, Key: pub}, PrivateKey{KeyNum: keyNum, Key: priv}, nil
+}
+
+// GenerateKeyFiles generates a new signify key pair and saves it into key files (like `signify -G`).
+// If password is empty then the secret key is saved unencrypted (like `signify -G -n`).
+func GenerateKeyFiles(privateKeyPath string, publicKeyPath string, password string) error {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	rounds := DefaultRounds
+	if password == "" {
+		rounds = 0
+	}
+	data, err := EncodePrivateKey(priv, password, rounds, "signify secret key")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(privateKeyPath, data, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(publicKeyPath, EncodePublicKey(pub, "signify public key"), 0644)
+}
+
+// EncodePublicKey returns the signify public key file content.
+func EncodePublicKey(key PublicKey, comment string) []byte {
+	b := make([]byte, 0, publicKeySize)
+	b = append(b, algEd...)
+	b = append(b, key.KeyNum[:]...)
+	b = append(b, key.Key...)
+	return encodeLines(comment, b)
+}
+
+// ParsePublicKey parses a signify public key file content.
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	b, _, err := decodeLines(data, publicKeySize)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	var key PublicKey
+	copy(key.KeyNum[:], b[2:10])
+	key.Key = ed25519.PublicKey(b[10:])
+	return key, nil
+}
+
+// ReadPublicKey reads a signify public key file.
+func ReadPublicKey(path string) (PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	return ParsePublicKey(data)
+}
+
+// EncodePrivateKey returns the signify secret key file content encrypted with a password using bcrypt_pbkdf.
+// If rounds is zero then the secret key is encoded unencrypted and the password is ignored.
+func EncodePrivateKey(key PrivateKey, password string, rounds int, comment string) ([]byte, error) {
+	if len(key.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signify: invalid Ed25519 private key size %d", len(key.Key))
+	}
+	if rounds < 0 {
+		return nil, fmt.Errorf("signify: invalid bcrypt_pbkdf rounds %d", rounds)
+	}
+	var salt [16]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	sum := sha512.Sum512(key.Key)
+	b := make([]byte, 0, secretKeySize)
+	b = append(b, algEd...)
+	b = append(b, kdfBcrypt...)
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(rounds))
+	b = append(b, buf[:]...)
+	b = append(b, salt[:]...)
+	b = append(b, sum[:8]...)
+	b = append(b, key.KeyNum[:]...)
+	b = append(b, key.Key...)
+	seckey := b[secretKeySize-ed25519.PrivateKeySize:]
+	if rounds > 0 {
+		xorKey, err := bcryptPBKDF([]byte(password), salt[:], rounds, ed25519.PrivateKeySize)
+		if err != nil {
+			return nil, err
+		}
+		xorBytes(seckey, xorKey)
+	}
+	return encodeLines(comment, b), nil
+}
+
+// ParsePrivateKey parses a signify secret key file content decrypting it with a password if it's encrypted.
+func ParsePrivateKey(data []byte, password string) (PrivateKey, error) {
+	b, _, err := decodeLines(data, secretKeySize)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if string(b[2:4]) != kdfBcrypt {
+		return PrivateKey{}, fmt.Errorf("signify: unsupported secret key derivation %q", b[2:4])
+	}
+	rounds := binary.BigEndian.Uint32(b[4:8])
+	salt := b[8:24]
+	checksum := b[24:32]
+	var key PrivateKey
+	copy(key.KeyNum[:], b[32:40])
+	seckey := b[40:]
+	if rounds > 0 {
+		xorKey, err := bcryptPBKDF([]byte(password), salt, int(rounds), ed25519.PrivateKeySize)
+		if err != nil {
+			return PrivateKey{}, err
+		}
+		xorBytes(seckey, xorKey)
+	}
+	sum := sha512.Sum512(seckey)
+	if subtle.ConstantTimeCompare(sum[:8], checksum) != 1 {
+		return PrivateKey{}, ErrWrongPassword
+	}
+	key.Key = ed25519.PrivateKey(seckey)
+	return key, nil
+}
+
+// ReadPrivateKey reads a signify secret key file decrypting it with a password if it's encrypted.
+func ReadPrivateKey(path string, password string) (PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return ParsePrivateKey(data, password)
+}
+
+// Sign signs the data read from r and returns the signify signature file content.
+func Sign(key PrivateKey, r io.Reader, comment string) ([]byte, error) {
+	if len(key.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signify: invalid Ed25519 private key size %d", len(key.Key))
+	}
+	msg, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, signatureSize)
+	b = append(b, algEd...)
+	b = append(b, key.KeyNum[:]...)
+	b = append(b, ed25519.Sign(key.Key, msg)...)
+	return encodeLines(comment, b), nil
+}
+
+// Verify checks a signify signature file content against the data read from r.
+func Verify(key PublicKey, r io.Reader, sig []byte) error {
+	b, _, err := decodeLines(sig, signatureSize)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(b[2:10], key.KeyNum[:]) {
+		return ErrKeyMismatch
+	}
+	if len(key.Key) != ed25519.PublicKeySize {
+		return fmt.Errorf("signify: invalid Ed25519 public key size %d", len(key.Key))
+	}
+	msg, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key.Key, msg, b[10:]) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignFile signs a file (e.g. a checksum file) and saves the signature into a `.sig` file next to it.
+// The untrusted comment names the public key file used to verify it like signify does.
+// It returns the signature file path or an error.
+func SignFile(key PrivateKey, file string, publicKeyPath string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sig, err := Sign(key, bytes.NewReader(data), "verify with "+filepath.Base(publicKeyPath))
+	if err != nil {
+		return "", err
+	}
+	sigFile := file + Ext
+	if err := ioutil.WriteFile(sigFile, sig, 0644); err != nil {
+		return "", err
+	}
+	return sigFile, nil
+}
+
+// VerifyFile checks a file against its signify signature file (like `signify -V`).
+// If sigFile is empty then the `.sig` file next to the file is used.
+func VerifyFile(key PublicKey, file string, sigFile string) error {
+	if strings.TrimSpace(sigFile) == "" {
+		sigFile = file + Ext
+	}
+	sig, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return Verify(key, bytes.NewReader(data), sig)
+}
+
+// encodeLines encodes an untrusted comment line followed by a base64-encoded data line.
+func encodeLines(comment string, data []byte) []byte {
+	return []byte(untrustedPrefix + comment + "\n" + base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+// decodeLines decodes the untrusted comment and base64-encoded data lines checking the data size and algorithm.
+func decodeLines(data []byte, size int) ([]byte, string, error) {
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], untrustedPrefix) {
+		return nil, "", errors.New("signify: invalid comment; must start with 'untrusted comment: '")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimRight(lines[1], "\r"))
+	if err != nil || len(b) != size {
+		return nil, "", errors.New("signify: invalid base64 encoding")
+	}
+	if string(b[:2]) != algEd {
+		return nil, "", errors.New("signify: unsupported file format")
+	}
+	return b, strings.TrimPrefix(lines[0], untrustedPrefix), nil
+}
+
+func xorBytes(dst []byte, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
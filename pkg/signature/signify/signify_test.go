@@ -0,0 +1,203 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Public key and signature over the message `Hello, World!\n` created by the signify tool
+// (from the sigstore/rekor test data).
+const (
+	testPublicKey = "untrusted comment: signify public key\n" +
+		"RWSZyj9wTc0QvAfiUA2zFbdxSpPGyXLc/Mcxn+7hd9f6+VP+jHu0bu8b\n"
+	testSignature = "untrusted comment: verify with signify.pub\n" +
+		"RWSZyj9wTc0QvMrf5en3xQSpQcAZCzNyW23BBPBPjQuFVek3KGzNtNCv60pob32eGBL9ZuuiG36GnvcOwFodj7l9dl1jbzNR6QE=\n"
+)
+
+func TestVerify(t *testing.T) {
+	pub, err := ParsePublicKey([]byte(testPublicKey))
+	if err != nil {
+		t.Fatalf("ParsePublicKey() error = %v", err)
+	}
+	// The key is encoded back byte for byte like signify does
+	if got := EncodePublicKey(pub, "signify public key"); string(got) != testPublicKey {
+		t.Errorf("EncodePublicKey() = %q, want %q", got, testPublicKey)
+	}
+	otherPub, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		key     PublicKey
+		message string
+		wantErr error
+	}{
+		{name: "valid signature", key: pub, message: "Hello, World!\n"},
+		{name: "tampered message", key: pub, message: "Hello, World?\n", wantErr: ErrInvalidSignature},
+		{name: "signature of another key", key: otherPub, message: "Hello, World!\n", wantErr: ErrKeyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.key, strings.NewReader(tt.message), []byte(testSignature)); err != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBcryptPBKDF(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		salt     string
+		rounds   int
+		want     string
+	}{
+		{
+			name:     "openbsd regress vector",
+			password: "password",
+			salt:     "salt",
+			rounds:   12,
+			want:     "1ae42c05d487bc02f64921a4ebe4ea93bcacfe135fda99974c06b7b01fae149a",
+		},
+		{
+			name:     "password and salt with NUL bytes",
+			password: "passwordy\x00PASSWORD\x00",
+			salt:     "salty\x00SALT\x00",
+			rounds:   3,
+			want:     "7f310bd3e78c3280c59ce4595211a2928e8d4ec744c1ed2efc9f764e3388e0ad",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bcryptPBKDF([]byte(tt.password), []byte(tt.salt), tt.rounds, 32)
+			if err != nil {
+				t.Fatalf("bcryptPBKDF() error = %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("bcryptPBKDF() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcryptHash(t *testing.T) {
+	pass, salt := make([]byte, 64), make([]byte, 64)
+	for i := range pass {
+		pass[i] = byte(i)
+		salt[i] = byte(i + 64)
+	}
+	got := make([]byte, bcryptBlockSize)
+	bcryptHash(got, pass, salt)
+	if want := "87904870eef9deddf8e7611a140106e6aaf1a363d9a2c504db356443721eb555"; hex.EncodeToString(got) != want {
+		t.Errorf("bcryptHash() = %x, want %v", got, want)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	_, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		password string
+		rounds   int
+		parsePw  string
+		wantErr  error
+	}{
+		{name: "unencrypted", rounds: 0},
+		{name: "encrypted", password: "secret", rounds: 4, parsePw: "secret"},
+		{name: "wrong passphrase", password: "secret", rounds: 4, parsePw: "guess", wantErr: ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodePrivateKey(priv, tt.password, tt.rounds, "signify secret key")
+			if err != nil {
+				t.Fatalf("EncodePrivateKey() error = %v", err)
+			}
+			got, err := ParsePrivateKey(data, tt.parsePw)
+			if err != tt.wantErr {
+				t.Fatalf("ParsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (got.KeyNum != priv.KeyNum || !bytes.Equal(got.Key, priv.Key)) {
+				t.Errorf("ParsePrivateKey() = %x, want %x", got.KeyNum, priv.KeyNum)
+			}
+		})
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("/tmp", "compactor-")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	privPath := filepath.Join(tmpDirPath, "release.sec")
+	pubPath := filepath.Join(tmpDirPath, "release.pub")
+	if err := GenerateKeyFiles(privPath, pubPath, ""); err != nil {
+		t.Fatalf("GenerateKeyFiles() error = %v", err)
+	}
+	priv, err := ReadPrivateKey(privPath, "")
+	if err != nil {
+		t.Fatalf("ReadPrivateKey() error = %v", err)
+	}
+	pub, err := ReadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("ReadPublicKey() error = %v", err)
+	}
+	otherPub, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	file := filepath.Join(tmpDirPath, "SHA256")
+	if err := ioutil.WriteFile(file, []byte("SHA256 (file.tar.gz) = abc\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	sigFile, err := SignFile(priv, file, pubPath)
+	if err != nil {
+		t.Fatalf("SignFile() error = %v", err)
+	}
+	sig, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !strings.HasPrefix(string(sig), "untrusted comment: verify with release.pub\n") {
+		t.Errorf("SignFile() signature = %q", sig)
+	}
+
+	tests := []struct {
+		name    string
+		key     PublicKey
+		content string
+		wantErr error
+	}{
+		{name: "valid signature", key: pub},
+		{name: "signature of another key", key: otherPub, wantErr: ErrKeyMismatch},
+		{name: "tampered file", key: pub, content: "SHA256 (file.tar.gz) = def\n", wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.content != "" {
+				if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("%v", err)
+				}
+			}
+			if err := VerifyFile(tt.key, file, ""); err != tt.wantErr {
+				t.Errorf("VerifyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ParsePublicKey([]byte("not a signify key\n")); err == nil {
+		t.Errorf("ParsePublicKey() error = %v, want malformed key error", err)
+	}
+}